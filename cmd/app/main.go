@@ -5,85 +5,48 @@ It loads configurations, initializes servers, and handles HTTP/HTTPS requests wi
 package main
 
 import (
+	"context"
 	"log"
-	"net/http"
-	"time"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/thetonbr/breezegate/internal/config"
-	"github.com/thetonbr/breezegate/internal/domain"
-	"github.com/thetonbr/breezegate/internal/handlers"
-	"github.com/thetonbr/breezegate/internal/services"
+	"github.com/thetonbr/breezegate/internal/gateway"
 )
 
-const (
-	defaultReadTimeout  = 30 * time.Second
-	defaultWriteTimeout = 30 * time.Second
-)
+const configFile = "config.json"
 
 // main initializes the load balancer, loads configurations, and starts the HTTP/HTTPS servers.
+// The configuration is reloaded on SIGHUP and whenever the file changes. On SIGINT or SIGTERM it
+// stops accepting connections and drains active requests before exiting; the exit code is 1 if they
+// could not be drained within the shutdown timeout.
 func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+
 	// Load configurations from the config.json file
-	cfg, err := config.LoadConfig("config.json")
+	cfg, err := config.LoadConfig(configFile)
 	if err != nil {
 		log.Fatalf("Error loading configuration: %s", err.Error())
 	}
 
-	// Initialize load balancer
-	lb := domain.NewLoadBalancer()
-
-	// Add routes and backend servers
-	for _, domainConfig := range cfg.Domains {
-		for _, route := range domainConfig.Routes {
-			var backends []*domain.Server
-			for _, backend := range route.Backends {
-				server, err := domain.NewServer(backend.URL)
-				if err != nil {
-					log.Fatalf("Error creating server: %s", err.Error())
-				}
-				backends = append(backends, server)
-
-				// Start health checks for each backend server
-				healthCheckInterval, err := time.ParseDuration(cfg.HealthCheckInterval)
-				if err != nil {
-					log.Fatalf("Error parsing health check interval: %s", err.Error())
-				}
-				go services.HealthCheck(server, healthCheckInterval)
-			}
-			lb.AddRoute(route.Path, backends)
-		}
+	// Initialize the load balancer, certificates and listeners from the configuration
+	gw := gateway.New(ctx, cfg)
+	if err = gw.Apply(cfg); err != nil {
+		log.Fatalf("Error applying configuration: %s", err.Error())
+	}
+	if err = gw.StartAdmin(cfg.Admin); err != nil {
+		log.Fatalf("Error configuring admin API: %s", err.Error())
 	}
+	go gw.WatchConfig(ctx, configFile)
 
-	// Initialize load balancer handler
-	lbHandler := handlers.NewLoadBalancerHandler(lb)
+	// Run until a termination signal arrives; a second signal terminates immediately
+	<-ctx.Done()
+	stop()
 
-	// Initialize ACME client for Let's Encrypt TLS certificates
-	for _, domainConfig := range cfg.Domains {
-		if domainConfig.UseTLS {
-			// Create ACME client for the domain
-			acmeClient, err := services.NewACMEClient(domainConfig.Email, domainConfig.DomainName)
-			if err != nil {
-				log.Fatalf("Error initializing ACME client: %s", err.Error())
-			}
-			// Start HTTPS server with Let's Encrypt
-			go handlers.SetupACMEAutoTLS(acmeClient, domainConfig.DomainName, lbHandler)
-		} else {
-			// Start HTTP server
-			go func() {
-				log.Printf("Starting HTTP server for domain %s on port %s", domainConfig.DomainName, cfg.Port)
-				server := &http.Server{
-					Addr:         cfg.Port,
-					Handler:      lbHandler,
-					ReadTimeout:  defaultReadTimeout,
-					WriteTimeout: defaultWriteTimeout,
-				}
-				err := server.ListenAndServe()
-				if err != nil {
-					log.Fatalf("Error starting HTTP server: %s\n", err.Error())
-				}
-			}()
-		}
+	if err = gw.Shutdown(); err != nil {
+		log.Printf("Shutdown did not complete cleanly: %s", err.Error())
+		os.Exit(1)
 	}
-
-	// Block to keep the server running
-	select {}
+	log.Printf("Shutdown complete")
 }
@@ -2,7 +2,11 @@ module github.com/thetonbr/breezegate
 
 go 1.23.2
 
-require github.com/go-acme/lego/v4 v4.24.0
+require (
+	github.com/go-acme/lego/v4 v4.24.0
+	golang.org/x/net v0.37.0
+	golang.org/x/sys v0.31.0
+)
 
 require (
 	github.com/cenkalti/backoff/v4 v4.3.0 // indirect
@@ -13,9 +17,7 @@ require (
 	github.com/miekg/dns v1.1.64 // indirect
 	golang.org/x/crypto v0.36.0 // indirect
 	golang.org/x/mod v0.23.0 // indirect
-	golang.org/x/net v0.37.0 // indirect
 	golang.org/x/sync v0.12.0 // indirect
-	golang.org/x/sys v0.31.0 // indirect
 	golang.org/x/text v0.23.0 // indirect
 	golang.org/x/time v0.11.0 // indirect
 	golang.org/x/tools v0.30.0 // indirect
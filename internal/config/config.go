@@ -7,6 +7,7 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 )
 
@@ -14,36 +15,198 @@ import (
 type Backend struct {
 	URL     string `json:"url"`
 	Healthy bool   `json:"healthy"`
+	State   string `json:"state,omitempty"`
+	Weight  int    `json:"weight,omitempty"`
 }
 
 // Route defines a routing path and its associated backends.
+// Match selects how the path is compared: "prefix" (default), "exact" or "regex". Algorithm selects
+// how backends are picked: "round_robin" (default), "random", "least_conn", "p2c" or "ring_hash",
+// which hashes the request value selected by HashKey.
 type Route struct {
-	Path     string    `json:"path"`
-	Backends []Backend `json:"backends"`
+	Path        string       `json:"path"`
+	Match       string       `json:"match,omitempty"`
+	Algorithm   string       `json:"algorithm,omitempty"`
+	HashKey     *HashKey     `json:"hashKey,omitempty"`
+	Affinity    *Affinity    `json:"affinity,omitempty"`
+	HealthCheck *HealthCheck `json:"healthCheck,omitempty"`
+	// OutlierDetection ejects backends whose live requests keep failing.
+	OutlierDetection *OutlierDetection `json:"outlierDetection,omitempty"`
+	Backends         []Backend         `json:"backends"`
+}
+
+// HealthCheck configures the active health checks of the backends of a route. Type selects the probe:
+// "http" (default), "tcp", which connects to the backend address, "grpc", which calls the standard
+// grpc.health.v1 service named by Service, or "exec", which runs Command and expects exit status 0.
+// Without further settings, a HEAD request is sent to each backend URL and must return status 200.
+// ExpectedStatus lists status codes ("200"), ranges ("200-399") or classes ("2xx"); BodyContains and
+// BodyRegex check the response body. Host overrides the Host header, or the authority of gRPC checks.
+// Timeout bounds a single check and Interval overrides the global healthCheckInterval. A backend
+// changes state after HealthyThreshold consecutive passed or UnhealthyThreshold consecutive failed
+// checks (1 if zero); with MaxBackoff, unhealthy backends are checked at an interval that doubles
+// after every failure up to MaxBackoff.
+type HealthCheck struct {
+	Type               string            `json:"type,omitempty"`
+	Service            string            `json:"service,omitempty"`
+	Command            []string          `json:"command,omitempty"`
+	Path               string            `json:"path,omitempty"`
+	Method             string            `json:"method,omitempty"`
+	Host               string            `json:"host,omitempty"`
+	Headers            map[string]string `json:"headers,omitempty"`
+	ExpectedStatus     []string          `json:"expectedStatus,omitempty"`
+	BodyContains       string            `json:"bodyContains,omitempty"`
+	BodyRegex          string            `json:"bodyRegex,omitempty"`
+	Timeout            string            `json:"timeout,omitempty"`
+	Interval           string            `json:"interval,omitempty"`
+	HealthyThreshold   int               `json:"healthyThreshold,omitempty"`
+	UnhealthyThreshold int               `json:"unhealthyThreshold,omitempty"`
+	MaxBackoff         string            `json:"maxBackoff,omitempty"`
+}
+
+// OutlierDetection configures passive health checking from live traffic. A backend is ejected after
+// ConsecutiveFailures failed requests in a row, or once FailurePercent of at least MinRequests requests
+// within Window failed. It stays ejected for BaseEjectionTime, one BaseEjectionTime longer for every
+// recent ejection up to MaxEjectionTime. At most MaxEjectionPercent of the backends of a route are
+// ejected at once.
+type OutlierDetection struct {
+	ConsecutiveFailures int    `json:"consecutiveFailures,omitempty"`
+	FailurePercent      int    `json:"failurePercent,omitempty"`
+	MinRequests         int    `json:"minRequests,omitempty"`
+	Window              string `json:"window,omitempty"`
+	BaseEjectionTime    string `json:"baseEjectionTime,omitempty"`
+	MaxEjectionTime     string `json:"maxEjectionTime,omitempty"`
+	MaxEjectionPercent  int    `json:"maxEjectionPercent,omitempty"`
+}
+
+// Affinity enables sticky sessions: BreezeGate issues a signed cookie that sends later requests of
+// the client to the same backend while it stays healthy. TTL is the lifetime of the cookie (a session
+// cookie if empty) and SameSite is "lax" (default), "strict" or "none".
+type Affinity struct {
+	CookieName string `json:"cookieName,omitempty"`
+	TTL        string `json:"ttl,omitempty"`
+	Secure     bool   `json:"secure,omitempty"`
+	HTTPOnly   bool   `json:"httpOnly,omitempty"`
+	SameSite   string `json:"sameSite,omitempty"`
+}
+
+// HashKey selects the request value hashed by the ring_hash algorithm: the client IP address ("ip",
+// the default), or the header, cookie or query parameter called Name ("header", "cookie", "query").
+type HashKey struct {
+	Source string `json:"source,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+// DNSProvider names the DNS provider used for dns-01 challenges ("cloudflare", "rfc2136" or "exec")
+// together with its provider-specific options such as credentials or the nameserver address.
+type DNSProvider struct {
+	Name    string            `json:"name"`
+	Options map[string]string `json:"options,omitempty"`
 }
 
 // Domain defines the domain configurations, including its routes and TLS usage.
+// DomainName may be a wildcard such as "*.example.com". Aliases are further host names served by
+// the same routes and included in the domain's certificate; wildcards need the dns-01 challenge.
+// Default marks the domain that serves requests whose Host header matches no configured domain.
+// Challenge selects the ACME challenge used for TLS domains: "dns-01" (default), "http-01" or
+// "tls-alpn-01". DNSProvider overrides the global ACME DNS provider for this domain.
+// CertFile and KeyFile serve a certificate from PEM files instead of ACME, with the optional CAFile
+// chain appended; the files are reloaded when they change. Plain HTTP requests for TLS domains are
+// redirected to HTTPS unless AllowHTTP is set, in which case the domain is served over both protocols.
 type Domain struct {
-	DomainName string  `json:"domainName"`
-	Email      string  `json:"email"`
-	Routes     []Route `json:"routes"`
-	UseTLS     bool    `json:"useTLS"`
+	DomainName  string       `json:"domainName"`
+	Aliases     []string     `json:"aliases,omitempty"`
+	Email       string       `json:"email"`
+	Routes      []Route      `json:"routes"`
+	UseTLS      bool         `json:"useTLS"`
+	AllowHTTP   bool         `json:"allowHTTP,omitempty"`
+	Default     bool         `json:"default,omitempty"`
+	Challenge   string       `json:"challenge,omitempty"`
+	DNSProvider *DNSProvider `json:"dnsProvider,omitempty"`
+	CertFile    string       `json:"certFile,omitempty"`
+	KeyFile     string       `json:"keyFile,omitempty"`
+	CAFile      string       `json:"caFile,omitempty"`
+}
+
+// EAB holds External Account Binding credentials issued by the CA.
+type EAB struct {
+	KeyID   string `json:"kid"`
+	HMACKey string `json:"hmacKey"`
+}
+
+// ACME holds the settings shared by all domains that obtain certificates through ACME.
+// DirectoryURL selects the CA (Let's Encrypt production by default) and CACertificates lists PEM
+// files trusted in addition to the system roots when talking to it. KeyType is one of "ec256",
+// "ec384", "rsa2048" (default), "rsa3072", "rsa4096" or "rsa8192".
+// StorageDir is where accounts and certificates are kept across restarts. DNSProvider is used for
+// dns-01 challenges of domains that do not name their own provider.
+// RenewBefore and RenewCheckInterval are durations such as "720h"; empty values use the defaults.
+type ACME struct {
+	DirectoryURL       string       `json:"directoryUrl,omitempty"`
+	CACertificates     []string     `json:"caCertificates,omitempty"`
+	KeyType            string       `json:"keyType,omitempty"`
+	EAB                *EAB         `json:"eab,omitempty"`
+	StorageDir         string       `json:"storageDir,omitempty"`
+	RenewBefore        string       `json:"renewBefore,omitempty"`
+	RenewCheckInterval string       `json:"renewCheckInterval,omitempty"`
+	DNSProvider        *DNSProvider `json:"dnsProvider,omitempty"`
+}
+
+// Admin configures the admin API listener. The API is only reachable on Address, which should be a
+// loopback address unless requests are authenticated with Token (sent as a bearer token) or with
+// client certificates signed by ClientCAFile, which requires CertFile and KeyFile for the listener.
+type Admin struct {
+	Address      string `json:"address"`
+	Token        string `json:"token,omitempty"`
+	CertFile     string `json:"certFile,omitempty"`
+	KeyFile      string `json:"keyFile,omitempty"`
+	ClientCAFile string `json:"clientCAFile,omitempty"`
 }
 
 // Config holds the global configuration settings for BreezeGate.
+// DefaultCertificate names the TLS domain whose certificate is served to clients that send no SNI.
+// RedirectStatus is the status code used to redirect plain HTTP requests for TLS domains to HTTPS.
+// ShutdownTimeout bounds how long active connections are drained on SIGTERM. ReloadInterval is how
+// often the configuration file is checked for changes. DrainTimeout is how long a draining backend
+// keeps serving requests pinned to it by session affinity. AffinityKey signs affinity cookies; without
+// it a random key is used, so cookies do not survive a restart. InitialHealth is the health status of
+// a new backend until its first health check: "healthy" (default), "unhealthy", or "config" to use
+// the healthy field of the backend.
 type Config struct {
 	Port                string   `json:"port"`
+	HTTPSPort           string   `json:"httpsPort,omitempty"`
+	RedirectStatus      int      `json:"redirectStatus,omitempty"`
 	HealthCheckInterval string   `json:"healthCheckInterval"`
+	ShutdownTimeout     string   `json:"shutdownTimeout,omitempty"`
+	ReloadInterval      string   `json:"reloadInterval,omitempty"`
+	DrainTimeout        string   `json:"drainTimeout,omitempty"`
+	AffinityKey         string   `json:"affinityKey,omitempty"`
+	InitialHealth       string   `json:"initialHealth,omitempty"`
+	DefaultCertificate  string   `json:"defaultCertificate,omitempty"`
+	ACME                ACME     `json:"acme"`
+	Admin               *Admin   `json:"admin,omitempty"`
 	Domains             []Domain `json:"domains"`
 }
 
-// LoadConfig reads the configuration file and parses it into a Config struct.
+// Clone returns a deep copy of the configuration that can be modified without affecting the original.
+func (c *Config) Clone() Config {
+	var clone Config
+	data, _ := json.Marshal(c)       //nolint:errcheck // Config only holds JSON-encodable values
+	_ = json.Unmarshal(data, &clone) //nolint:errcheck // data was just marshaled from a Config
+	return clone
+}
+
+// LoadConfig reads the configuration file, parses it into a Config struct and validates it.
 func LoadConfig(file string) (Config, error) {
 	var config Config
 	data, err := os.ReadFile(file)
 	if err != nil {
 		return config, err
 	}
-	err = json.Unmarshal(data, &config)
-	return config, err
+	if err = json.Unmarshal(data, &config); err != nil {
+		return config, err
+	}
+	if err = config.Validate(); err != nil {
+		return config, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return config, nil
 }
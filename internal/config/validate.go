@@ -0,0 +1,448 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Validate checks the configuration for mistakes that would otherwise only surface while it is being
+// applied, so that a bad configuration can be rejected as a whole. All problems found are returned
+// together.
+func (c *Config) Validate() error {
+	v := &validator{}
+	if c.Port == "" {
+		v.addf("port is required")
+	}
+	v.duration("healthCheckInterval", c.HealthCheckInterval, true)
+	v.duration("shutdownTimeout", c.ShutdownTimeout, false)
+	v.duration("reloadInterval", c.ReloadInterval, false)
+	v.duration("drainTimeout", c.DrainTimeout, false)
+	switch c.RedirectStatus {
+	case 0, http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		v.addf("redirectStatus: %d is not a redirect status code", c.RedirectStatus)
+	}
+
+	c.ACME.validate(v)
+	if c.Admin != nil {
+		c.Admin.validate(v)
+	}
+	c.validateInitialHealth(v)
+
+	hosts := make(map[string]bool)
+	backends := make(map[string]sharedBackend)
+	defaults := 0
+	for i := range c.Domains {
+		c.Domains[i].validate(v, hosts, backends)
+		if c.Domains[i].Default {
+			defaults++
+		}
+	}
+	if defaults > 1 {
+		v.addf("only one domain can be the default, got %d", defaults)
+	}
+	if c.DefaultCertificate != "" && !hosts[strings.ToLower(c.DefaultCertificate)] {
+		v.addf("defaultCertificate: unknown domain %q", c.DefaultCertificate)
+	}
+	return errors.Join(v.errs...)
+}
+
+// validateInitialHealth checks the initial health mode. When it uses the healthy field of the
+// backends, a backend used by several routes must have the same value in all of them.
+func (c *Config) validateInitialHealth(v *validator) {
+	switch c.InitialHealth {
+	case "", "healthy", "unhealthy":
+		return
+	case "config":
+	default:
+		v.addf("initialHealth: unknown mode %q", c.InitialHealth)
+		return
+	}
+
+	healthy := make(map[string]bool)
+	for _, d := range c.Domains {
+		for _, route := range d.Routes {
+			for _, backend := range route.Backends {
+				if other, seen := healthy[backend.URL]; seen && other != backend.Healthy {
+					v.addf("domain %s: route %s: backend %q: healthy %v conflicts with %v elsewhere",
+						d.DomainName, route.Path, backend.URL, backend.Healthy, other)
+				}
+				healthy[backend.URL] = backend.Healthy
+			}
+		}
+	}
+}
+
+// dnsProviderOptions lists the options every DNS provider accepts; see services.NewDNSProvider.
+var dnsProviderOptions = map[string][]string{
+	"cloudflare": {
+		"email", "apiKey", "dnsApiToken", "zoneApiToken", "baseUrl",
+		"ttl", "propagationTimeout", "pollingInterval",
+	},
+	"rfc2136": {
+		"nameserver", "tsigKey", "tsigSecret", "tsigAlgorithm", "tsigFile", "dnsTimeout", "sequenceInterval",
+		"ttl", "propagationTimeout", "pollingInterval",
+	},
+	"exec": {"program", "mode", "sequenceInterval", "propagationTimeout", "pollingInterval"},
+}
+
+// dnsProviderRequired names the option a DNS provider cannot do without.
+var dnsProviderRequired = map[string]string{"rfc2136": "nameserver", "exec": "program"}
+
+func (a *ACME) validate(v *validator) {
+	switch strings.ToLower(a.KeyType) {
+	case "", "ec256", "ec384", "rsa2048", "rsa3072", "rsa4096", "rsa8192":
+	default:
+		v.addf("acme.keyType: unknown key type %q", a.KeyType)
+	}
+	v.duration("acme.renewBefore", a.RenewBefore, false)
+	v.duration("acme.renewCheckInterval", a.RenewCheckInterval, false)
+	if a.DNSProvider != nil {
+		a.DNSProvider.validate(v, "acme.dnsProvider: ")
+	}
+}
+
+// validate checks the provider name and options. Durations and the TTL are checked here, while
+// credentials can only be checked by the provider.
+func (p *DNSProvider) validate(v *validator, prefix string) {
+	name := p.Name
+	if name == "" {
+		name = "cloudflare"
+	}
+	known, exists := dnsProviderOptions[name]
+	if !exists {
+		v.addf("%sunknown DNS provider %q", prefix, p.Name)
+		return
+	}
+	if required := dnsProviderRequired[name]; required != "" && p.Options[required] == "" {
+		v.addf("%soption %s is required by %s", prefix, required, name)
+	}
+	for key, value := range p.Options {
+		switch {
+		case !slices.Contains(known, key):
+			v.addf("%sunknown option %q for %s", prefix, key, name)
+		case key == "ttl":
+			if ttl, err := strconv.Atoi(value); err != nil || ttl <= 0 {
+				v.addf("%sinvalid ttl %q", prefix, value)
+			}
+		case strings.HasSuffix(key, "Timeout") || strings.HasSuffix(key, "Interval"):
+			v.duration(prefix+key, value, false)
+		}
+	}
+}
+
+// validate checks the domain. hosts collects the host names of all domains and backends the settings
+// of every backend URL, which must be the same wherever the backend is used.
+func (d *Domain) validate(v *validator, hosts map[string]bool, backends map[string]sharedBackend) {
+	if d.DomainName == "" {
+		v.addf("domain: domainName is required")
+		return
+	}
+	prefix := "domain " + d.DomainName + ": "
+
+	names := append([]string{d.DomainName}, d.Aliases...)
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if hosts[name] {
+			v.addf("%shost name %q is configured more than once", prefix, name)
+		}
+		hosts[name] = true
+	}
+
+	switch d.Challenge {
+	case "", "dns-01":
+	case "http-01", "tls-alpn-01":
+		for _, name := range names {
+			if strings.HasPrefix(name, "*.") && d.UseTLS && d.CertFile == "" {
+				v.addf("%swildcard name %q requires the dns-01 challenge", prefix, name)
+			}
+		}
+	default:
+		v.addf("%sunknown challenge %q", prefix, d.Challenge)
+	}
+	if (d.CertFile == "") != (d.KeyFile == "") {
+		v.addf("%scertFile and keyFile must be set together", prefix)
+	}
+	if d.DNSProvider != nil {
+		d.DNSProvider.validate(v, prefix+"dnsProvider: ")
+	}
+
+	paths := make(map[string]bool)
+	for _, route := range d.Routes {
+		if paths[route.Path] {
+			v.addf("%sroute %q is configured more than once", prefix, route.Path)
+		}
+		paths[route.Path] = true
+		route.validate(v, prefix+"route "+route.Path+": ", backends)
+	}
+}
+
+func (r *Route) validate(v *validator, prefix string, backends map[string]sharedBackend) {
+	if r.Path == "" {
+		v.addf("%spath is required", prefix)
+	}
+	switch r.Match {
+	case "", "prefix", "exact":
+	case "regex":
+		if _, err := regexp.Compile(r.Path); err != nil {
+			v.addf("%sinvalid regular expression: %s", prefix, err.Error())
+		}
+	default:
+		v.addf("%sunknown match type %q", prefix, r.Match)
+	}
+	r.validateAlgorithm(v, prefix)
+	if r.Affinity != nil {
+		r.Affinity.validate(v, prefix)
+	}
+	if r.HealthCheck != nil {
+		r.HealthCheck.validate(v, prefix)
+	}
+	if r.OutlierDetection != nil {
+		r.OutlierDetection.validate(v, prefix)
+	}
+	r.validateBackends(v, prefix, backends)
+}
+
+func (r *Route) validateAlgorithm(v *validator, prefix string) {
+	switch r.Algorithm {
+	case "", "round_robin", "random", "least_conn", "p2c":
+		if r.HashKey != nil {
+			v.addf("%shashKey requires the ring_hash algorithm", prefix)
+		}
+	case "ring_hash":
+		if r.HashKey != nil {
+			r.HashKey.validate(v, prefix)
+		}
+	default:
+		v.addf("%sunknown algorithm %q", prefix, r.Algorithm)
+	}
+}
+
+func (r *Route) validateBackends(v *validator, prefix string, backends map[string]sharedBackend) {
+	if len(r.Backends) == 0 {
+		v.addf("%sat least one backend is required", prefix)
+	}
+	for _, backend := range r.Backends {
+		parsed, err := url.Parse(backend.URL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			v.addf("%sinvalid backend URL %q", prefix, backend.URL)
+		}
+		switch backend.State {
+		case "", "active", "draining", "disabled":
+		default:
+			v.addf("%sbackend %q: unknown state %q", prefix, backend.URL, backend.State)
+		}
+		if backend.Weight < 0 {
+			v.addf("%sbackend %q: weight must not be negative", prefix, backend.URL)
+		}
+		if backend.State == "" {
+			backend.State = "active"
+		}
+		backend.Weight = max(backend.Weight, 1)
+		shared := sharedBackend{Backend: backend, healthCheck: r.HealthCheck}
+		shared.validate(v, prefix, backends)
+	}
+}
+
+// sharedBackend holds the settings of a backend that belong to its running server rather than to a
+// route, with defaults filled in.
+type sharedBackend struct {
+	Backend
+	healthCheck *HealthCheck
+}
+
+// validate checks that a backend used by several routes has the same settings in all of them, since
+// they share one running server.
+func (b sharedBackend) validate(v *validator, prefix string, backends map[string]sharedBackend) {
+	other, seen := backends[b.URL]
+	if !seen {
+		backends[b.URL] = b
+		return
+	}
+	if other.State != b.State {
+		v.addf("%sbackend %q: state %q conflicts with %q elsewhere", prefix, b.URL, b.State, other.State)
+	}
+	if other.Weight != b.Weight {
+		v.addf("%sbackend %q: weight %d conflicts with %d elsewhere", prefix, b.URL, b.Weight, other.Weight)
+	}
+	if !reflect.DeepEqual(other.healthCheck, b.healthCheck) {
+		v.addf("%sbackend %q: healthCheck conflicts with the one of another route", prefix, b.URL)
+	}
+}
+
+func (k *HashKey) validate(v *validator, prefix string) {
+	switch k.Source {
+	case "", "ip":
+	case "header", "cookie", "query":
+		if k.Name == "" {
+			v.addf("%shashKey: source %q requires a name", prefix, k.Source)
+		}
+	default:
+		v.addf("%shashKey: unknown source %q", prefix, k.Source)
+	}
+}
+
+func (a *Affinity) validate(v *validator, prefix string) {
+	v.duration(prefix+"affinity.ttl", a.TTL, false)
+	switch a.SameSite {
+	case "", "lax", "strict":
+	case "none":
+		if !a.Secure {
+			v.addf("%saffinity: sameSite none requires secure", prefix)
+		}
+	default:
+		v.addf("%saffinity: unknown sameSite %q", prefix, a.SameSite)
+	}
+}
+
+func (h *HealthCheck) validate(v *validator, prefix string) {
+	prefix += "healthCheck: "
+	switch h.Type {
+	case "", "http":
+		h.validateHTTP(v, prefix)
+	case "tcp", "grpc", "exec":
+		if h.hasHTTPSettings() {
+			v.addf("%spath, method, headers, expectedStatus, bodyContains and bodyRegex require the http type", prefix)
+		}
+		if h.Host != "" && h.Type != "grpc" {
+			v.addf("%shost requires the http or grpc type", prefix)
+		}
+	default:
+		v.addf("%sunknown type %q", prefix, h.Type)
+	}
+	if h.Service != "" && h.Type != "grpc" {
+		v.addf("%sservice requires the grpc type", prefix)
+	}
+	if (len(h.Command) > 0) != (h.Type == "exec") {
+		v.addf("%sthe exec type and command must be set together", prefix)
+	}
+	v.duration(prefix+"timeout", h.Timeout, false)
+	v.duration(prefix+"interval", h.Interval, false)
+	v.duration(prefix+"maxBackoff", h.MaxBackoff, false)
+	if h.HealthyThreshold < 0 || h.UnhealthyThreshold < 0 {
+		v.addf("%sthresholds must not be negative", prefix)
+	}
+}
+
+// hasHTTPSettings reports whether any setting only used by HTTP health checks is set.
+func (h *HealthCheck) hasHTTPSettings() bool {
+	return h.Path != "" || h.Method != "" || len(h.Headers) > 0 || len(h.ExpectedStatus) > 0 ||
+		h.BodyContains != "" || h.BodyRegex != ""
+}
+
+// validateHTTP checks the settings of an HTTP health check.
+func (h *HealthCheck) validateHTTP(v *validator, prefix string) {
+	if h.Path != "" && !strings.HasPrefix(h.Path, "/") {
+		v.addf("%spath %q must start with /", prefix, h.Path)
+	}
+	if h.Method != "" && (strings.ContainsAny(h.Method, " \t/") || strings.ToUpper(h.Method) != h.Method) {
+		v.addf("%sinvalid method %q", prefix, h.Method)
+	}
+	if h.Method == http.MethodHead && (h.BodyContains != "" || h.BodyRegex != "") {
+		v.addf("%schecking the body requires a method other than HEAD", prefix)
+	}
+	for _, status := range h.ExpectedStatus {
+		if _, _, err := ParseStatusRange(status); err != nil {
+			v.addf("%s%s", prefix, err.Error())
+		}
+	}
+	if h.BodyRegex != "" {
+		if _, err := regexp.Compile(h.BodyRegex); err != nil {
+			v.addf("%sinvalid bodyRegex: %s", prefix, err.Error())
+		}
+	}
+}
+
+func (o *OutlierDetection) validate(v *validator, prefix string) {
+	prefix += "outlierDetection: "
+	if o.ConsecutiveFailures <= 0 && o.FailurePercent <= 0 {
+		v.addf("%sconsecutiveFailures or failurePercent is required", prefix)
+	}
+	if o.ConsecutiveFailures < 0 || o.MinRequests < 0 {
+		v.addf("%scounts must not be negative", prefix)
+	}
+	if o.FailurePercent < 0 || o.FailurePercent > 100 || o.MaxEjectionPercent < 0 || o.MaxEjectionPercent > 100 {
+		v.addf("%spercentages must be between 0 and 100", prefix)
+	}
+	v.duration(prefix+"window", o.Window, false)
+	v.duration(prefix+"baseEjectionTime", o.BaseEjectionTime, false)
+	v.duration(prefix+"maxEjectionTime", o.MaxEjectionTime, false)
+}
+
+// ParseStatusRange parses an expected status of a health check: a status code such as "200", a range
+// such as "200-399", or a class such as "2xx". It returns the lowest and highest status included.
+func ParseStatusRange(value string) (low, high int, err error) {
+	if class, found := strings.CutSuffix(strings.ToLower(value), "xx"); found {
+		digit, convErr := strconv.Atoi(class)
+		if convErr != nil || len(class) != 1 || digit < 1 || digit > 5 {
+			return 0, 0, fmt.Errorf("invalid status class %q", value)
+		}
+		return digit * 100, digit*100 + 99, nil
+	}
+	lowText, highText, isRange := strings.Cut(value, "-")
+	if !isRange {
+		highText = lowText
+	}
+	low, lowErr := strconv.Atoi(lowText)
+	high, highErr := strconv.Atoi(highText)
+	if lowErr != nil || highErr != nil || low < 100 || high > 599 || low > high {
+		return 0, 0, fmt.Errorf("invalid status %q", value)
+	}
+	return low, high, nil
+}
+
+func (a *Admin) validate(v *validator) {
+	host, _, err := net.SplitHostPort(a.Address)
+	if err != nil {
+		v.addf("admin: invalid address %q", a.Address)
+		return
+	}
+	if a.ClientCAFile != "" && (a.CertFile == "" || a.KeyFile == "") {
+		v.addf("admin: clientCAFile requires certFile and keyFile")
+	}
+	if (a.CertFile == "") != (a.KeyFile == "") {
+		v.addf("admin: certFile and keyFile must be set together")
+	}
+	if a.Token == "" && a.ClientCAFile == "" && !isLoopback(host) {
+		v.addf("admin: a token or clientCAFile is required when listening on %q", a.Address)
+	}
+}
+
+// isLoopback reports whether a listen host only accepts local connections.
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// validator collects validation errors.
+type validator struct {
+	errs []error
+}
+
+func (v *validator) addf(format string, args ...any) {
+	v.errs = append(v.errs, fmt.Errorf(format, args...))
+}
+
+func (v *validator) duration(field, value string, required bool) {
+	if value == "" {
+		if required {
+			v.addf("%s is required", field)
+		}
+		return
+	}
+	if duration, err := time.ParseDuration(value); err != nil || duration <= 0 {
+		v.addf("%s: invalid duration %q", field, value)
+	}
+}
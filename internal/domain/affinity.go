@@ -0,0 +1,135 @@
+package domain
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultAffinityCookieName is the name of the affinity cookie unless configured otherwise.
+const DefaultAffinityCookieName = "breezegate_affinity"
+
+// AffinityCookie holds the attributes of the cookie that pins a client to a backend. A zero TTL makes
+// it a session cookie. Path is set from the route the affinity is added to; empty means "/".
+type AffinityCookie struct {
+	Name     string
+	Path     string
+	TTL      time.Duration
+	Secure   bool
+	HTTPOnly bool
+	SameSite http.SameSite
+}
+
+// Affinity pins clients to the backend that served their first request by issuing a cookie that
+// names it. The cookie is signed, so clients cannot forge it to pick a backend of their choice, and
+// names the backend by a hash of its URL, so backend addresses are not revealed.
+type Affinity struct {
+	cookie AffinityCookie
+	key    []byte
+}
+
+// NewAffinity creates session affinity that issues cookies with the given attributes, signed with key.
+// Cookies stay valid across reloads and between BreezeGate instances that share the key.
+func NewAffinity(cookie AffinityCookie, key []byte) *Affinity {
+	if cookie.Name == "" {
+		cookie.Name = DefaultAffinityCookieName
+	}
+	return &Affinity{cookie: cookie, key: key}
+}
+
+// forRoute returns the affinity of the route with the given host, path and match type. Cookies of
+// prefix and exact routes are limited to the paths of the route, so routes sharing a cookie name do not
+// overwrite each other's cookies. Regex routes cannot limit their cookies to their paths, so with the
+// default name they get a cookie name of their own instead.
+func (a *Affinity) forRoute(host, path string, match MatchType) *Affinity {
+	scoped := *a
+	switch {
+	case match != MatchRegex:
+		scoped.cookie.Path = path
+	case a.cookie.Name == DefaultAffinityCookieName:
+		scoped.cookie.Name += "_" + strconv.FormatUint(hashString(host+" "+path), 36)
+	}
+	return &scoped
+}
+
+// Backend returns the backend the request is pinned to by a valid, unexpired cookie, or nil if there
+// is none or the backend cannot take it. Draining backends keep their clients until the drain
+// timeout passes. Clients send the cookies of every enclosing route path too, so the first one naming
+// a backend of this route wins.
+func (a *Affinity) Backend(r *http.Request, backends []*Server) *Server {
+	for _, cookie := range r.CookiesNamed(a.cookie.Name) {
+		id, ok := a.verify(cookie.Value)
+		if !ok {
+			continue
+		}
+		for _, server := range backends {
+			if backendID(server) == id {
+				if server.AcceptsAffinity() {
+					return server
+				}
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// Cookie returns the cookie that pins later requests to the server.
+func (a *Affinity) Cookie(server *Server) *http.Cookie {
+	value := backendID(server)
+	if a.cookie.TTL > 0 {
+		value += "." + strconv.FormatInt(time.Now().Add(a.cookie.TTL).Unix(), 10)
+	}
+	cookie := &http.Cookie{
+		Name:     a.cookie.Name,
+		Value:    value + "." + a.sign(value),
+		Path:     a.cookie.Path,
+		Secure:   a.cookie.Secure,
+		HttpOnly: a.cookie.HTTPOnly,
+		SameSite: a.cookie.SameSite,
+	}
+	if cookie.Path == "" {
+		cookie.Path = "/"
+	}
+	if a.cookie.TTL > 0 {
+		cookie.MaxAge = int(a.cookie.TTL.Seconds())
+	}
+	return cookie
+}
+
+// verify checks the signature and expiry of a cookie value and returns the backend ID it names.
+func (a *Affinity) verify(value string) (string, bool) {
+	// The signature follows the payload, which is the backend ID optionally followed by the expiry time
+	i := strings.LastIndexByte(value, '.')
+	if i < 0 {
+		return "", false
+	}
+	payload, signature := value[:i], value[i+1:]
+	if !hmac.Equal([]byte(signature), []byte(a.sign(payload))) {
+		return "", false
+	}
+	id, expiry, hasExpiry := strings.Cut(payload, ".")
+	if hasExpiry {
+		expires, err := strconv.ParseInt(expiry, 10, 64)
+		if err != nil || time.Now().Unix() > expires {
+			return "", false
+		}
+	}
+	return id, true
+}
+
+// sign returns the signature of a cookie payload.
+func (a *Affinity) sign(payload string) string {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(a.cookie.Name + "=" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// backendID identifies a backend in affinity cookies without revealing its URL.
+func backendID(server *Server) string {
+	return strconv.FormatUint(hashString(server.URL.String()), 36)
+}
@@ -0,0 +1,206 @@
+package domain
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// Algorithm names a load balancing algorithm that can be chosen per route.
+type Algorithm string
+
+const (
+	// AlgorithmRoundRobin picks backends in turn, in proportion to their weights.
+	AlgorithmRoundRobin Algorithm = "round_robin"
+	// AlgorithmRandom picks a random backend, weighted by the backend weights.
+	AlgorithmRandom Algorithm = "random"
+	// AlgorithmLeastConn picks the backend with the fewest requests in flight relative to its weight.
+	AlgorithmLeastConn Algorithm = "least_conn"
+	// AlgorithmP2C picks two random backends and uses the one with fewer requests in flight relative
+	// to its weight.
+	AlgorithmP2C Algorithm = "p2c"
+	// AlgorithmRingHash sends requests with the same key to the same backend by consistent hashing.
+	AlgorithmRingHash Algorithm = "ring_hash"
+)
+
+// BalancerOptions holds the settings of the algorithms that need them.
+type BalancerOptions struct {
+	// HashKey selects the request value hashed by AlgorithmRingHash.
+	HashKey HashKey
+}
+
+// Balancer picks the backend server of a route that serves a request. Every route has its own
+// balancer, so implementations can keep per-route state; they must be safe for concurrent use.
+type Balancer interface {
+	// Next returns one of the available backends for the request, or nil if none is available. The
+	// request carries the context hash-based algorithms need, such as headers and the client address.
+	Next(r *http.Request, backends []*Server) *Server
+}
+
+// rotationInheritor is implemented by balancers that can continue the state of the balancer of a
+// route they replace, so reloading the configuration does not start their rotation over.
+type rotationInheritor interface {
+	inherit(old Balancer, backends []*Server)
+}
+
+// NewBalancer creates a balancer for the named algorithm. An empty name means AlgorithmRoundRobin.
+func NewBalancer(algorithm Algorithm, opts BalancerOptions) (Balancer, error) {
+	switch algorithm {
+	case "", AlgorithmRoundRobin:
+		return &roundRobinBalancer{}, nil
+	case AlgorithmRandom:
+		return randomBalancer{}, nil
+	case AlgorithmLeastConn:
+		return &leastConnBalancer{}, nil
+	case AlgorithmP2C:
+		return p2cBalancer{}, nil
+	case AlgorithmRingHash:
+		if opts.HashKey.Source == "" {
+			opts.HashKey.Source = HashSourceIP
+		}
+		return &ringHashBalancer{key: opts.HashKey}, nil
+	default:
+		return nil, fmt.Errorf("unknown load balancing algorithm %q", algorithm)
+	}
+}
+
+// roundRobinBalancer implements smooth weighted Round Robin: every available backend gains its
+// weight, the one with the highest gain is picked and loses the total of all weights. Backends are
+// picked in proportion to their weights and interleaved, so a heavy backend does not receive its
+// requests in bursts; with equal weights this is plain Round Robin.
+type roundRobinBalancer struct {
+	currentWeights map[*Server]int
+	mu             sync.Mutex
+}
+
+// Next implements Balancer.
+func (b *roundRobinBalancer) Next(_ *http.Request, backends []*Server) *Server {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.currentWeights == nil {
+		b.currentWeights = make(map[*Server]int, len(backends))
+	}
+
+	var best *Server
+	total := 0
+	for _, server := range backends {
+		if !server.IsAvailable() {
+			continue
+		}
+		weight := server.Weight()
+		b.currentWeights[server] += weight
+		total += weight
+		if best == nil || b.currentWeights[server] > b.currentWeights[best] {
+			best = server
+		}
+	}
+	if best != nil {
+		b.currentWeights[best] -= total
+	}
+	return best
+}
+
+// inherit copies the state of the backends shared with an old round robin balancer.
+func (b *roundRobinBalancer) inherit(old Balancer, backends []*Server) {
+	oldBalancer, ok := old.(*roundRobinBalancer)
+	if !ok {
+		return
+	}
+	oldBalancer.mu.Lock()
+	defer oldBalancer.mu.Unlock()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.currentWeights = make(map[*Server]int, len(backends))
+	for _, server := range backends {
+		if weight, exists := oldBalancer.currentWeights[server]; exists {
+			b.currentWeights[server] = weight
+		}
+	}
+}
+
+// randomBalancer picks a random available backend with a probability proportional to its weight.
+type randomBalancer struct{}
+
+// Next implements Balancer.
+func (randomBalancer) Next(_ *http.Request, backends []*Server) *Server {
+	available, total := availableBackends(backends)
+	if total == 0 {
+		return nil
+	}
+	n := rand.N(total) //nolint:gosec // load balancing does not need a secure source
+	for _, server := range available {
+		n -= server.Weight()
+		if n < 0 {
+			return server
+		}
+	}
+	return available[len(available)-1]
+}
+
+// leastConnBalancer picks the available backend with the fewest requests in flight relative to its
+// weight. Ties are broken by rotating through the backends, so idle backends share the requests.
+type leastConnBalancer struct {
+	offset atomic.Uint64
+}
+
+// Next implements Balancer.
+func (b *leastConnBalancer) Next(_ *http.Request, backends []*Server) *Server {
+	available, _ := availableBackends(backends)
+	if len(available) == 0 {
+		return nil
+	}
+	start := int(b.offset.Add(1) % uint64(len(available)))
+	best := available[start]
+	for i := 1; i < len(available); i++ {
+		server := available[(start+i)%len(available)]
+		if lessLoaded(server, best) {
+			best = server
+		}
+	}
+	return best
+}
+
+// p2cBalancer implements the power of two random choices: it picks two different available backends
+// at random and uses the one with fewer requests in flight relative to its weight. This avoids the
+// herd behavior of always picking the least loaded backend while staying close to it.
+type p2cBalancer struct{}
+
+// Next implements Balancer.
+func (p2cBalancer) Next(_ *http.Request, backends []*Server) *Server {
+	available, _ := availableBackends(backends)
+	switch len(available) {
+	case 0:
+		return nil
+	case 1:
+		return available[0]
+	}
+	i := rand.N(len(available))     //nolint:gosec // load balancing does not need a secure source
+	j := rand.N(len(available) - 1) //nolint:gosec // load balancing does not need a secure source
+	if j >= i {
+		j++
+	}
+	if lessLoaded(available[j], available[i]) {
+		return available[j]
+	}
+	return available[i]
+}
+
+// lessLoaded reports whether a has fewer requests in flight than b relative to their weights.
+func lessLoaded(a, b *Server) bool {
+	return a.InFlight()*int64(b.Weight()) < b.InFlight()*int64(a.Weight())
+}
+
+// availableBackends returns the backends that can receive new requests and the total of their weights.
+func availableBackends(backends []*Server) ([]*Server, int) {
+	var available []*Server
+	total := 0
+	for _, server := range backends {
+		if server.IsAvailable() {
+			available = append(available, server)
+			total += server.Weight()
+		}
+	}
+	return available, total
+}
@@ -0,0 +1,38 @@
+package domain
+
+import (
+	"net"
+	"strings"
+)
+
+const wildcardPrefix = "*."
+
+// normalizeHost lowercases a host name and strips any port and trailing dot from it.
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// isWildcardHost reports whether a normalized host name is a wildcard such as "*.example.com".
+func isWildcardHost(name string) bool {
+	return strings.HasPrefix(name, wildcardPrefix)
+}
+
+// matchesWildcard reports whether host is a subdomain covered by the wildcard pattern.
+// The pattern "*.example.com" matches "api.example.com" and "a.b.example.com" but not "example.com".
+func matchesWildcard(pattern, host string) bool {
+	suffix := pattern[len(wildcardPrefix)-1:]
+	return len(host) > len(suffix) && strings.HasSuffix(host, suffix)
+}
+
+// MatchHost reports whether the Host header host is served by the host name pattern, which may be a
+// wildcard. Case, ports and trailing dots are ignored.
+func MatchHost(pattern, host string) bool {
+	pattern, host = normalizeHost(pattern), normalizeHost(host)
+	if isWildcardHost(pattern) {
+		return matchesWildcard(pattern, host)
+	}
+	return pattern == host
+}
@@ -4,65 +4,275 @@ Package domain contains the core logic for the load balancer, including routing
 package domain
 
 import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
 	"sync"
 )
 
 // Route represents a URL path and its associated backend servers.
 type Route struct {
 	Path     string
+	Match    MatchType
 	Backends []*Server
-	current  int
-	mu       sync.Mutex
+	pattern  *regexp.Regexp
+	balancer Balancer
+	affinity *Affinity
+	outlier  *outlierDetector
+}
+
+// RouteOptions holds the optional settings of a route.
+type RouteOptions struct {
+	// Balancer picks the backends of the route; nil means smooth weighted Round Robin.
+	Balancer Balancer
+	// Affinity pins clients to a backend with a cookie limited to the route; nil disables it.
+	Affinity *Affinity
+	// OutlierDetection ejects backends whose requests keep failing from the route; nil disables it.
+	// Other routes using the same backends are not affected.
+	OutlierDetection *OutlierDetection
+}
+
+// VirtualHost groups the routes served for one host name. Names starting with "*." match every
+// subdomain of the rest of the name.
+type VirtualHost struct {
+	Name string
+	routeTable
+}
+
+// wildcardHost maps a wildcard host name to the virtual host it serves.
+type wildcardHost struct {
+	pattern string
+	vhost   *VirtualHost
 }
 
 // LoadBalancer manages the routing of requests to backend servers based on defined routes.
+//
+// Requests are first matched to a virtual host by their Host header: exact names win over wildcard
+// names, and longer wildcards win over shorter ones. Requests that match no virtual host go to the
+// default host if one is set, and to the routes added without a host otherwise.
 type LoadBalancer struct {
-	Routes map[string]*Route
-	mu     sync.RWMutex
+	routeTable
+	hosts       map[string]*VirtualHost
+	wildcards   []wildcardHost
+	defaultHost string
+	mu          sync.RWMutex
 }
 
 // NewLoadBalancer creates a new instance of LoadBalancer.
 func NewLoadBalancer() *LoadBalancer {
 	return &LoadBalancer{
-		Routes: make(map[string]*Route),
+		routeTable: newRouteTable(),
+		hosts:      make(map[string]*VirtualHost),
 	}
 }
 
-// AddRoute adds a new route and its associated backends to the load balancer.
+// AddRoute adds a new prefix route and its associated backends to the load balancer.
 func (lb *LoadBalancer) AddRoute(path string, backends []*Server) {
-	lb.mu.Lock()
-	defer lb.mu.Unlock()
-	lb.Routes[path] = &Route{
+	_ = lb.AddRouteWithMatch(path, MatchPrefix, backends) //nolint:errcheck // prefix routes have no pattern to fail
+}
+
+// AddRouteWithMatch adds a new route that compares request paths using the given match type.
+func (lb *LoadBalancer) AddRouteWithMatch(path string, match MatchType, backends []*Server) error {
+	return lb.AddHostRoute("", path, match, backends)
+}
+
+// AddHostRoute adds a new route to the virtual host with the given name, creating the host if needed.
+// An empty host adds the route to the routes used when no virtual host matches.
+func (lb *LoadBalancer) AddHostRoute(host, path string, match MatchType, backends []*Server) error {
+	return lb.AddHostRouteWithOptions(host, path, match, RouteOptions{}, backends)
+}
+
+// AddHostRouteWithOptions adds a new route like AddHostRoute with the given options.
+func (lb *LoadBalancer) AddHostRouteWithOptions(
+	host, path string, match MatchType, opts RouteOptions, backends []*Server,
+) error {
+	match, err := ParseMatchType(string(match))
+	if err != nil {
+		return err
+	}
+	if opts.Balancer == nil {
+		opts.Balancer = &roundRobinBalancer{}
+	}
+	if opts.Affinity != nil {
+		opts.Affinity = opts.Affinity.forRoute(host, path, match)
+	}
+	route := &Route{
 		Path:     path,
+		Match:    match,
 		Backends: backends,
+		balancer: opts.Balancer,
+		affinity: opts.Affinity,
+		outlier:  newOutlierDetector(opts.OutlierDetection),
+	}
+	if err := route.compilePattern(); err != nil {
+		return err
 	}
+
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	if host == "" {
+		lb.add(route)
+		return nil
+	}
+	lb.virtualHost(normalizeHost(host)).add(route)
+	return nil
 }
 
-// GetBackendForPath retrieves a healthy backend server for the given path using Round Robin algorithm.
+// AddHostAlias makes requests for alias use the routes of the virtual host with the given name,
+// creating the host if needed. Aliases may be wildcards.
+func (lb *LoadBalancer) AddHostAlias(alias, host string) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	lb.registerHost(normalizeHost(alias), lb.virtualHost(normalizeHost(host)))
+}
+
+// SetDefaultHost makes the named virtual host serve requests whose Host header matches no virtual host.
+func (lb *LoadBalancer) SetDefaultHost(host string) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	lb.defaultHost = normalizeHost(host)
+}
+
+// Replace atomically swaps in all routes, virtual hosts and the default host of next, which must not
+// be used afterwards. Requests that already selected a backend are not affected; every later request
+// is routed by the new tables. Routes that exist in both keep the rotation of their balancer if it
+// supports that, so a reload does not send a burst of requests to the first backends, and keep the
+// servers that outlier detection ejected.
+func (lb *LoadBalancer) Replace(next *LoadBalancer) {
+	next.mu.Lock()
+	defer next.mu.Unlock()
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	next.inheritRotation(&lb.routeTable)
+	for name, vhost := range next.hosts {
+		if old, exists := lb.hosts[name]; exists {
+			vhost.inheritRotation(&old.routeTable)
+		}
+	}
+	lb.routeTable = next.routeTable
+	lb.hosts = next.hosts
+	lb.wildcards = next.wildcards
+	lb.defaultHost = next.defaultHost
+}
+
+// Host returns the virtual host registered under the given name, or nil if there is none.
+func (lb *LoadBalancer) Host(name string) *VirtualHost {
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
+	return lb.hosts[normalizeHost(name)]
+}
+
+// GetBackendForPath retrieves a healthy backend server for the given path using the balancer of its
+// route. The path is resolved to a route by exact match first, then by regex, then by longest prefix.
 func (lb *LoadBalancer) GetBackendForPath(path string) *Server {
+	return lb.GetBackend("", path)
+}
+
+// GetBackend retrieves a healthy backend server for the given Host header and path. Balancers see a
+// request with only the host and path set.
+func (lb *LoadBalancer) GetBackend(host, path string) *Server {
+	server, _ := lb.SelectBackend(&http.Request{Host: host, URL: &url.URL{Path: path}, Header: http.Header{}})
+	return server
+}
+
+// SelectBackend retrieves a healthy backend server for the request, routed by its Host header and URL
+// path. The balancer of the route sees the whole request. If the route has session affinity, a
+// request pinned to a backend that can still take it goes there, and the returned cookie pins the
+// client to the selected backend; it must be set on the response.
+func (lb *LoadBalancer) SelectBackend(r *http.Request) (*Server, *http.Cookie) {
 	lb.mu.RLock()
-	route, exists := lb.Routes[path]
+	route := lb.tableForHost(r.Host).match(r.URL.Path)
 	lb.mu.RUnlock()
-	if !exists {
-		return nil
+	if route == nil {
+		return nil, nil
+	}
+	backends := route.Backends
+	if route.outlier != nil {
+		backends = route.outlier.admitted(backends)
+	}
+	if route.affinity == nil {
+		return route.balancer.Next(r, backends), nil
 	}
 
-	route.mu.Lock()
-	defer route.mu.Unlock()
+	server := route.affinity.Backend(r, backends)
+	if server == nil {
+		server = route.balancer.Next(r, backends)
+	}
+	if server == nil {
+		return nil, nil
+	}
+	// The cookie is issued on every response so its expiry slides while the client is active
+	return server, route.affinity.Cookie(server)
+}
 
-	numBackends := len(route.Backends)
-	if numBackends == 0 {
-		return nil
+// RecordOutcome records whether the request, proxied to server after SelectBackend, failed: the server
+// could not be reached, did not answer in time or answered with a 5xx status. If the route of the
+// request has outlier detection, a server that keeps failing is ejected; RecordOutcome reports
+// whether this outcome ejected it.
+func (lb *LoadBalancer) RecordOutcome(r *http.Request, server *Server, failed bool) bool {
+	lb.mu.RLock()
+	route := lb.tableForHost(r.Host).match(r.URL.Path)
+	lb.mu.RUnlock()
+	if route == nil || route.outlier == nil || !slices.Contains(route.Backends, server) {
+		return false
 	}
+	return route.outlier.record(server, failed, route.Backends)
+}
 
-	for i := 0; i < numBackends; i++ {
-		idx := route.current % numBackends
-		server := route.Backends[idx]
-		route.current++
+// virtualHost returns the virtual host with the given normalized name, creating it if needed.
+// The caller must hold the write lock.
+func (lb *LoadBalancer) virtualHost(name string) *VirtualHost {
+	if vhost, exists := lb.hosts[name]; exists {
+		return vhost
+	}
+	vhost := &VirtualHost{
+		Name:       name,
+		routeTable: newRouteTable(),
+	}
+	lb.registerHost(name, vhost)
+	return vhost
+}
+
+// registerHost indexes a virtual host under the given normalized name. The caller must hold the write lock.
+func (lb *LoadBalancer) registerHost(name string, vhost *VirtualHost) {
+	lb.hosts[name] = vhost
+	if !isWildcardHost(name) {
+		return
+	}
 
-		if server.GetHealthStatus() {
-			return server
+	lb.wildcards = slices.DeleteFunc(lb.wildcards, func(w wildcardHost) bool { return w.pattern == name })
+	lb.wildcards = append(lb.wildcards, wildcardHost{pattern: name, vhost: vhost})
+	sort.SliceStable(lb.wildcards, func(i, j int) bool {
+		return len(lb.wildcards[i].pattern) > len(lb.wildcards[j].pattern)
+	})
+}
+
+// tableForHost returns the routes that serve the given Host header. The caller must hold the read lock.
+func (lb *LoadBalancer) tableForHost(host string) *routeTable {
+	name := normalizeHost(host)
+	if vhost, exists := lb.hosts[name]; exists && !isWildcardHost(name) {
+		return &vhost.routeTable
+	}
+	for _, w := range lb.wildcards {
+		if matchesWildcard(w.pattern, name) {
+			return &w.vhost.routeTable
 		}
 	}
-	return nil
+	if vhost, exists := lb.hosts[lb.defaultHost]; exists {
+		return &vhost.routeTable
+	}
+	return &lb.routeTable
+}
+
+// inheritRotation continues the state of the balancer of old if both use the same kind of balancer,
+// and the ejections of outlier detection if both have it.
+func (r *Route) inheritRotation(old *Route) {
+	if inheritor, ok := r.balancer.(rotationInheritor); ok {
+		inheritor.inherit(old.balancer, r.Backends)
+	}
+	if r.outlier != nil && old.outlier != nil {
+		r.outlier.inherit(old.outlier, r.Backends)
+	}
 }
@@ -0,0 +1,225 @@
+package domain
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	defaultOutlierWindow      = 10 * time.Second
+	defaultBaseEjectionTime   = 30 * time.Second
+	defaultMaxEjectionTime    = 5 * time.Minute
+	defaultMaxEjectionPercent = 50
+	defaultOutlierMinRequests = 1
+	percent                   = 100
+)
+
+// OutlierDetection configures passive health checking: a server whose proxied requests keep failing
+// is ejected from its routes for a while, without waiting for an active health check to notice.
+// A request fails if the server cannot be reached, does not answer in time or answers with a 5xx
+// status.
+type OutlierDetection struct {
+	// ConsecutiveFailures ejects a server after this many failed requests in a row; zero disables it.
+	ConsecutiveFailures int
+	// FailurePercent ejects a server once this percentage of its requests within Window failed;
+	// zero disables it.
+	FailurePercent int
+	// MinRequests is the number of requests a window needs before FailurePercent applies; zero means 1.
+	MinRequests int
+	// Window is the period over which FailurePercent is measured; zero means 10 seconds.
+	Window time.Duration
+	// BaseEjectionTime is how long a server is ejected the first time; every further ejection lasts
+	// one BaseEjectionTime longer. Zero means 30 seconds.
+	BaseEjectionTime time.Duration
+	// MaxEjectionTime caps how long a server is ejected; zero means 5 minutes.
+	MaxEjectionTime time.Duration
+	// MaxEjectionPercent is the largest share of the servers of a route that may be ejected at once;
+	// zero means 50. Whatever the share, the last available server of a route is never ejected, so a
+	// route is never emptied by ejections alone.
+	MaxEjectionPercent int
+}
+
+// withDefaults returns the settings with zero values replaced by their defaults.
+func (o OutlierDetection) withDefaults() OutlierDetection {
+	if o.MinRequests <= 0 {
+		o.MinRequests = defaultOutlierMinRequests
+	}
+	if o.Window <= 0 {
+		o.Window = defaultOutlierWindow
+	}
+	if o.BaseEjectionTime <= 0 {
+		o.BaseEjectionTime = defaultBaseEjectionTime
+	}
+	if o.MaxEjectionTime <= 0 {
+		o.MaxEjectionTime = defaultMaxEjectionTime
+	}
+	if o.MaxEjectionPercent <= 0 {
+		o.MaxEjectionPercent = defaultMaxEjectionPercent
+	}
+	return o
+}
+
+// outlierDetector ejects the failing servers of one route. It keeps its own counters for every
+// server, so a server shared with other routes is only ejected from the route it fails in.
+type outlierDetector struct {
+	settings OutlierDetection
+	states   map[*Server]*outlierState
+	// mu guards states and serializes ejections so that MaxEjectionPercent holds under concurrent
+	// failures.
+	mu sync.Mutex
+}
+
+func newOutlierDetector(settings *OutlierDetection) *outlierDetector {
+	if settings == nil {
+		return nil
+	}
+	return &outlierDetector{settings: settings.withDefaults(), states: make(map[*Server]*outlierState)}
+}
+
+// record counts the outcome of a request proxied to server, one of backends, and ejects the server
+// if it crossed a threshold and the route can spare it: ejecting it keeps the ejected share within
+// MaxEjectionPercent and leaves another available server.
+func (d *outlierDetector) record(server *Server, failed bool, backends []*Server) bool {
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	state, exists := d.states[server]
+	if !exists {
+		state = &outlierState{}
+		d.states[server] = state
+	}
+	if !state.recordOutcome(failed, &d.settings, now) {
+		return false
+	}
+
+	ejected, othersAvailable := 0, false
+	for _, backend := range backends {
+		switch {
+		case d.isEjected(backend, now):
+			ejected++
+		case backend != server && backend.IsAvailable():
+			othersAvailable = true
+		}
+	}
+	if !othersAvailable || (ejected+1)*percent > d.settings.MaxEjectionPercent*len(backends) {
+		return false
+	}
+	state.eject(&d.settings, now)
+	server.markEjected(state.ejectedUntil)
+	return true
+}
+
+// admitted returns the backends that are not ejected from the route. It returns backends itself if
+// none is ejected.
+func (d *outlierDetector) admitted(backends []*Server) []*Server {
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i, server := range backends {
+		if !d.isEjected(server, now) {
+			continue
+		}
+		admitted := slices.Clone(backends[:i])
+		for _, other := range backends[i+1:] {
+			if !d.isEjected(other, now) {
+				admitted = append(admitted, other)
+			}
+		}
+		return admitted
+	}
+	return backends
+}
+
+// inherit continues the counters and ejections of the servers of old that are still backends, so
+// reloading the configuration does not readmit failing servers.
+func (d *outlierDetector) inherit(old *outlierDetector, backends []*Server) {
+	old.mu.Lock()
+	defer old.mu.Unlock()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, server := range backends {
+		if state, exists := old.states[server]; exists {
+			inherited := *state
+			d.states[server] = &inherited
+		}
+	}
+}
+
+// isEjected reports whether server is ejected from the route. The caller must hold the lock.
+func (d *outlierDetector) isEjected(server *Server, now time.Time) bool {
+	state, exists := d.states[server]
+	return exists && now.Before(state.ejectedUntil)
+}
+
+// outlierState holds the passive health checking counters of a server in one route.
+type outlierState struct {
+	// consecutive counts the failed requests since the last successful one.
+	consecutive int
+	// requests and failures count the requests of the window starting at windowStart.
+	windowStart time.Time
+	requests    int
+	failures    int
+	// ejections counts recent ejections, making each ejection last longer; it decreases by one for
+	// every window the server gets through without being ejected.
+	ejections    int
+	ejectedUntil time.Time
+}
+
+// recordOutcome counts the outcome of a request and reports whether the server crossed a threshold
+// of settings. Requests that finish while the server is ejected are not counted.
+func (o *outlierState) recordOutcome(failed bool, settings *OutlierDetection, now time.Time) bool {
+	if now.Before(o.ejectedUntil) {
+		return false
+	}
+	if now.Sub(o.windowStart) >= settings.Window {
+		if !o.windowStart.IsZero() {
+			o.ejections = max(o.ejections-int(now.Sub(o.windowStart)/settings.Window), 0)
+		}
+		o.windowStart = now
+		o.requests = 0
+		o.failures = 0
+	}
+
+	o.requests++
+	if !failed {
+		o.consecutive = 0
+		return false
+	}
+	o.failures++
+	o.consecutive++
+	if settings.ConsecutiveFailures > 0 && o.consecutive >= settings.ConsecutiveFailures {
+		return true
+	}
+	return settings.FailurePercent > 0 && o.requests >= settings.MinRequests &&
+		o.failures*percent >= settings.FailurePercent*o.requests
+}
+
+// eject takes the server out of the route for an ejection time that grows with recent ejections.
+func (o *outlierState) eject(settings *OutlierDetection, now time.Time) {
+	o.ejections++
+	ejection := min(settings.BaseEjectionTime*time.Duration(o.ejections), settings.MaxEjectionTime)
+	o.ejectedUntil = now.Add(ejection)
+	// Counting starts over once the server is readmitted
+	o.consecutive = 0
+	o.requests = 0
+	o.failures = 0
+	o.windowStart = o.ejectedUntil
+}
+
+// markEjected records that a route ejected the server until the given time.
+func (s *Server) markEjected(until time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if until.After(s.ejectedUntil) {
+		s.ejectedUntil = until
+	}
+}
+
+// IsEjected reports whether outlier detection currently ejects the server from at least one of its
+// routes. Other routes using the server keep sending requests to it.
+func (s *Server) IsEjected() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return time.Now().Before(s.ejectedUntil)
+}
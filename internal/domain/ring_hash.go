@@ -0,0 +1,175 @@
+package domain
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// ringPointsPerWeight is the number of points a backend of weight 1 has on the hash ring. More points
+// spread keys more evenly across backends.
+const ringPointsPerWeight = 100
+
+// HashSource names the part of a request that a hash-based balancer derives its key from.
+type HashSource string
+
+const (
+	// HashSourceIP hashes the client IP address.
+	HashSourceIP HashSource = "ip"
+	// HashSourceHeader hashes the value of a request header.
+	HashSourceHeader HashSource = "header"
+	// HashSourceCookie hashes the value of a cookie.
+	HashSourceCookie HashSource = "cookie"
+	// HashSourceQuery hashes the value of a query parameter.
+	HashSourceQuery HashSource = "query"
+)
+
+// HashKey selects the request value that decides which backend a request is sent to. Name is the
+// header, cookie or query parameter to use and is ignored for HashSourceIP.
+type HashKey struct {
+	Source HashSource
+	Name   string
+}
+
+// ParseHashKey converts configuration values into a HashKey. An empty source means HashSourceIP.
+func ParseHashKey(source, name string) (HashKey, error) {
+	switch HashSource(source) {
+	case "", HashSourceIP:
+		return HashKey{Source: HashSourceIP}, nil
+	case HashSourceHeader, HashSourceCookie, HashSourceQuery:
+		if name == "" {
+			return HashKey{}, fmt.Errorf("hash source %q requires a name", source)
+		}
+		return HashKey{Source: HashSource(source), Name: name}, nil
+	default:
+		return HashKey{}, fmt.Errorf("unknown hash source %q", source)
+	}
+}
+
+// value returns the key of the request. Requests without the header, cookie or query parameter are
+// keyed by their client IP address instead.
+func (k HashKey) value(r *http.Request) string {
+	var value string
+	switch k.Source {
+	case HashSourceHeader:
+		value = r.Header.Get(k.Name)
+	case HashSourceCookie:
+		if cookie, err := r.Cookie(k.Name); err == nil {
+			value = cookie.Value
+		}
+	case HashSourceQuery:
+		value = r.URL.Query().Get(k.Name)
+	case HashSourceIP:
+	}
+	if value == "" {
+		return ClientIP(r)
+	}
+	return value
+}
+
+// ClientIP returns the IP address of the client that sent the request, taken from the connection
+// rather than from headers the client controls.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ringPoint is a point on the hash ring owned by a backend.
+type ringPoint struct {
+	hash   uint64
+	server *Server
+}
+
+// ringHashBalancer implements consistent hashing: every backend owns points on a ring in proportion
+// to its weight, and a request goes to the owner of the first point at or after the hash of its key.
+// When a backend joins or leaves, only the keys of the points it gains or loses move. If the owner
+// does not accept the request, the next backend on the ring takes it.
+//
+// Hashing is a form of session affinity, so draining backends keep their keys until the drain
+// timeout passes.
+type ringHashBalancer struct {
+	key HashKey
+	// ring is rebuilt when the backends or their weights change, and never modified in place.
+	ring     []ringPoint
+	backends []*Server
+	weights  []int
+	mu       sync.Mutex
+}
+
+// Next implements Balancer.
+func (b *ringHashBalancer) Next(r *http.Request, backends []*Server) *Server {
+	ring := b.ringFor(backends)
+	if len(ring) == 0 {
+		return nil
+	}
+
+	hash := hashString(b.key.value(r))
+	start := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= hash })
+	var tried map[*Server]bool
+	for i := range ring {
+		server := ring[(start+i)%len(ring)].server
+		if tried[server] {
+			continue
+		}
+		if server.AcceptsAffinity() {
+			return server
+		}
+		if tried == nil {
+			tried = make(map[*Server]bool, len(backends))
+		}
+		tried[server] = true
+		if len(tried) == len(backends) {
+			break
+		}
+	}
+	return nil
+}
+
+// ringFor returns the ring of the backends, rebuilding it if they or their weights have changed.
+func (b *ringHashBalancer) ringFor(backends []*Server) []ringPoint {
+	weights := make([]int, len(backends))
+	for i, server := range backends {
+		weights[i] = server.Weight()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.ring != nil && slices.Equal(b.backends, backends) && slices.Equal(b.weights, weights) {
+		return b.ring
+	}
+
+	ring := make([]ringPoint, 0, len(backends)*ringPointsPerWeight)
+	for i, server := range backends {
+		name := server.URL.String()
+		for point := range weights[i] * ringPointsPerWeight {
+			ring = append(ring, ringPoint{hash: hashString(name + "#" + strconv.Itoa(point)), server: server})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+	b.ring, b.backends, b.weights = ring, slices.Clone(backends), weights
+	return ring
+}
+
+// hashString hashes a string for the ring. Hashes are stable across processes, so every instance of
+// BreezeGate sends the same key to the same backend.
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s)) //nolint:errcheck // writing to a hash never fails
+	// FNV-1a alone clusters similar inputs such as the point names of one backend, so the bits are
+	// mixed with the SplitMix64 finalizer.
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,213 @@
+package domain
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// MatchType determines how a route path is compared against a request path.
+type MatchType string
+
+const (
+	// MatchPrefix matches the route path and every path below it on a segment boundary.
+	MatchPrefix MatchType = "prefix"
+	// MatchExact matches the route path only.
+	MatchExact MatchType = "exact"
+	// MatchRegex treats the route path as a regular expression.
+	MatchRegex MatchType = "regex"
+)
+
+// ParseMatchType converts a configuration value into a MatchType. An empty value means MatchPrefix.
+func ParseMatchType(value string) (MatchType, error) {
+	switch MatchType(value) {
+	case "", MatchPrefix:
+		return MatchPrefix, nil
+	case MatchExact:
+		return MatchExact, nil
+	case MatchRegex:
+		return MatchRegex, nil
+	default:
+		return "", fmt.Errorf("unknown route match type %q", value)
+	}
+}
+
+// routeTable holds the routes of a single host and resolves request paths to them.
+//
+// Exact routes win over everything else, regex routes are tried next in the order they were added,
+// and prefix routes are resolved last by picking the longest matching prefix.
+type routeTable struct {
+	// Routes indexes every route of the table by its configured path.
+	Routes   map[string]*Route
+	exact    map[string]*Route
+	regexes  []*Route
+	prefixes *pathNode
+}
+
+func newRouteTable() routeTable {
+	return routeTable{
+		Routes:   make(map[string]*Route),
+		exact:    make(map[string]*Route),
+		prefixes: &pathNode{},
+	}
+}
+
+// add registers a route, replacing any route previously registered for the same path.
+func (t *routeTable) add(route *Route) {
+	if old, exists := t.Routes[route.Path]; exists {
+		t.remove(old)
+	}
+	t.Routes[route.Path] = route
+
+	switch route.Match {
+	case MatchExact:
+		t.exact[route.Path] = route
+	case MatchRegex:
+		t.regexes = append(t.regexes, route)
+	case MatchPrefix:
+		t.prefixes.insert(route.Path, route)
+	}
+}
+
+// inheritRotation continues the rotation of the routes in old for the routes with the same path,
+// for the backends they have in common.
+func (t *routeTable) inheritRotation(old *routeTable) {
+	for path, route := range t.Routes {
+		if oldRoute, exists := old.Routes[path]; exists && oldRoute != route {
+			route.inheritRotation(oldRoute)
+		}
+	}
+}
+
+// remove unregisters a route from the table.
+func (t *routeTable) remove(route *Route) {
+	delete(t.Routes, route.Path)
+
+	switch route.Match {
+	case MatchExact:
+		delete(t.exact, route.Path)
+	case MatchRegex:
+		for i, r := range t.regexes {
+			if r == route {
+				t.regexes = append(t.regexes[:i:i], t.regexes[i+1:]...)
+				break
+			}
+		}
+	case MatchPrefix:
+		t.prefixes.remove(route.Path)
+	}
+}
+
+// match returns the route that serves the given request path, or nil if none does. The path is
+// cleaned first, so dot segments cannot reach a route through another one.
+func (t *routeTable) match(requestPath string) *Route {
+	cleaned := CleanPath(requestPath)
+	if route, exists := t.exact[cleaned]; exists {
+		return route
+	}
+	for _, route := range t.regexes {
+		if route.pattern.MatchString(cleaned) {
+			return route
+		}
+	}
+	return t.prefixes.longestPrefix(cleaned)
+}
+
+// CleanPath returns the request path with "." and ".." segments resolved and repeated slashes removed,
+// the way a backend interprets it. A trailing slash is kept.
+func CleanPath(requestPath string) string {
+	if requestPath == "" {
+		return "/"
+	}
+	if requestPath[0] != '/' {
+		requestPath = "/" + requestPath
+	}
+	cleaned := path.Clean(requestPath)
+	if strings.HasSuffix(requestPath, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// pathNode is a segment trie: every edge is one path segment, so prefixes can only match on '/'
+// boundaries and the cost of a lookup depends on the depth of the path, not on the number of routes.
+type pathNode struct {
+	children map[string]*pathNode
+	route    *Route
+}
+
+func (n *pathNode) insert(p string, route *Route) {
+	node := n
+	forEachSegment(p, func(segment string) bool {
+		if node.children == nil {
+			node.children = make(map[string]*pathNode)
+		}
+		child, exists := node.children[segment]
+		if !exists {
+			child = &pathNode{}
+			node.children[segment] = child
+		}
+		node = child
+		return true
+	})
+	node.route = route
+}
+
+func (n *pathNode) remove(p string) {
+	node := n
+	forEachSegment(p, func(segment string) bool {
+		node = node.children[segment]
+		return node != nil
+	})
+	if node != nil {
+		node.route = nil
+	}
+}
+
+func (n *pathNode) longestPrefix(p string) *Route {
+	node := n
+	best := n.route
+	forEachSegment(p, func(segment string) bool {
+		node = node.children[segment]
+		if node == nil {
+			return false
+		}
+		if node.route != nil {
+			best = node.route
+		}
+		return true
+	})
+	return best
+}
+
+// forEachSegment calls fn for every non-empty segment of p until fn returns false.
+func forEachSegment(p string, fn func(segment string) bool) {
+	for p != "" {
+		var segment string
+		if i := strings.IndexByte(p, '/'); i >= 0 {
+			segment, p = p[:i], p[i+1:]
+		} else {
+			segment, p = p, ""
+		}
+		if segment == "" {
+			continue
+		}
+		if !fn(segment) {
+			return
+		}
+	}
+}
+
+// compilePattern prepares the regular expression of a regex route.
+func (r *Route) compilePattern() error {
+	if r.Match != MatchRegex {
+		return nil
+	}
+	pattern, err := regexp.Compile(r.Path)
+	if err != nil {
+		return fmt.Errorf("invalid route pattern %q: %w", r.Path, err)
+	}
+	r.pattern = pattern
+	return nil
+}
@@ -1,16 +1,59 @@
 package domain
 
 import (
+	"fmt"
 	"net/http/httputil"
 	"net/url"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// AdminState is the administrative state of a backend server, set by an operator independently of
+// its health.
+type AdminState string
+
+const (
+	// StateActive servers receive new requests while they are healthy.
+	StateActive AdminState = "active"
+	// StateDraining servers receive no new requests, but requests pinned to them by session affinity
+	// keep arriving until the drain timeout passes, e.g. while they are taken out for a deploy.
+	StateDraining AdminState = "draining"
+	// StateDisabled servers receive no requests at all.
+	StateDisabled AdminState = "disabled"
+)
+
+// ParseAdminState converts a configuration value into an AdminState. An empty value means StateActive.
+func ParseAdminState(value string) (AdminState, error) {
+	switch AdminState(value) {
+	case "", StateActive:
+		return StateActive, nil
+	case StateDraining:
+		return StateDraining, nil
+	case StateDisabled:
+		return StateDisabled, nil
+	default:
+		return "", fmt.Errorf("unknown backend state %q", value)
+	}
+}
+
 // Server represents a backend server that receives traffic from the load balancer.
 type Server struct {
 	URL       *url.URL
 	IsHealthy bool
-	mu        sync.Mutex
+	// state is the administrative state; the zero value means StateActive.
+	state AdminState
+	// drainDeadline ends the affinity of a draining server; zero means it never ends.
+	drainDeadline time.Time
+	// weight is the share of requests the server receives relative to the other servers of a route;
+	// the zero value means 1.
+	weight int
+	// forcedHealth overrides IsHealthy when set by an operator, until it is cleared.
+	forcedHealth *bool
+	// ejectedUntil is the end of the latest ejection from one of its routes by outlier detection.
+	ejectedUntil time.Time
+	inFlight     atomic.Int64
+	mu           sync.Mutex
 }
 
 // NewServer creates a new Server instance with the provided URL.
@@ -34,12 +77,146 @@ func (s *Server) SetHealthStatus(isHealthy bool) {
 }
 
 // GetHealthStatus returns the current health status of the server (true = healthy, false = unhealthy).
+// A forced health status takes precedence over the one determined by health checks.
 func (s *Server) GetHealthStatus() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.forcedHealth != nil {
+		return *s.forcedHealth
+	}
+	return s.IsHealthy
+}
+
+// CheckedHealthStatus returns the health status determined by health checks, ignoring a forced one.
+func (s *Server) CheckedHealthStatus() bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	return s.IsHealthy
 }
 
+// ForceHealthStatus pins the health status of the server regardless of health check results.
+func (s *Server) ForceHealthStatus(isHealthy bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.forcedHealth = &isHealthy
+}
+
+// ClearForcedHealthStatus lets health checks determine the health status of the server again.
+func (s *Server) ClearForcedHealthStatus() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.forcedHealth = nil
+}
+
+// IsHealthForced reports whether the health status of the server is pinned by ForceHealthStatus.
+func (s *Server) IsHealthForced() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.forcedHealth != nil
+}
+
+// SetAdminState changes the administrative state of the server. A server that starts draining keeps
+// the requests pinned to it by session affinity for drainTimeout, or until it is activated or disabled
+// again if drainTimeout is zero. Setting the state the server already has changes nothing, so
+// reapplying the same configuration does not restart a drain. Requests already sent to the server
+// are never affected.
+func (s *Server) SetAdminState(state AdminState, drainTimeout time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.adminState() == state {
+		return
+	}
+	s.state = state
+	s.drainDeadline = time.Time{}
+	if state == StateDraining && drainTimeout > 0 {
+		s.drainDeadline = time.Now().Add(drainTimeout)
+	}
+}
+
+// AdminState returns the administrative state of the server.
+func (s *Server) AdminState() AdminState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.adminState()
+}
+
+// IsAvailable reports whether the server can receive new requests: it is healthy and active. Routes
+// with outlier detection also skip the servers they ejected.
+func (s *Server) IsAvailable() bool {
+	return s.GetHealthStatus() && s.AdminState() == StateActive
+}
+
+// AcceptsAffinity reports whether requests pinned to the server by session affinity may still be sent
+// to it: it is healthy, and either active or draining within the drain timeout.
+func (s *Server) AcceptsAffinity() bool {
+	if !s.GetHealthStatus() {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch s.adminState() {
+	case StateActive:
+		return true
+	case StateDraining:
+		return s.drainDeadline.IsZero() || time.Now().Before(s.drainDeadline)
+	case StateDisabled:
+		return false
+	}
+	return false
+}
+
+// IsDrained reports whether a server that is draining or disabled no longer serves anything: it has no
+// requests in flight, or its drain timeout has passed. Active servers are never drained.
+func (s *Server) IsDrained() bool {
+	s.mu.Lock()
+	state, deadline := s.adminState(), s.drainDeadline
+	s.mu.Unlock()
+	if state == StateActive {
+		return false
+	}
+	return s.InFlight() == 0 || (!deadline.IsZero() && time.Now().After(deadline))
+}
+
+// SetWeight changes the share of requests the server receives relative to the other servers of a
+// route. Weights below 1 mean 1. The rotation of routes using the server continues with the new weight.
+func (s *Server) SetWeight(weight int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.weight = weight
+}
+
+// Weight returns the weight of the server, at least 1.
+func (s *Server) Weight() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return max(s.weight, 1)
+}
+
+// StartRequest records a request being sent to the server. Every call must be followed by EndRequest
+// once the response has been delivered.
+func (s *Server) StartRequest() {
+	s.inFlight.Add(1)
+}
+
+// EndRequest records that a request started with StartRequest has finished.
+func (s *Server) EndRequest() {
+	s.inFlight.Add(-1)
+}
+
+// InFlight returns the number of requests currently being served by the server.
+func (s *Server) InFlight() int64 {
+	return s.inFlight.Load()
+}
+
+// adminState returns the administrative state, mapping the zero value to StateActive. The caller must
+// hold the lock.
+func (s *Server) adminState() AdminState {
+	if s.state == "" {
+		return StateActive
+	}
+	return s.state
+}
+
 // ReverseProxy returns a reverse proxy that forwards the requests to the backend server.
 func (s *Server) ReverseProxy() *httputil.ReverseProxy {
 	return httputil.NewSingleHostReverseProxy(s.URL)
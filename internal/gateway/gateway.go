@@ -0,0 +1,487 @@
+/*
+Package gateway runs BreezeGate: it applies configurations to the load balancer, the certificates of
+the TLS domains and the listeners, reloads the configuration file when it changes and shuts
+everything down gracefully.
+*/
+package gateway
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net"
+	"net/http"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/thetonbr/breezegate/internal/config"
+	"github.com/thetonbr/breezegate/internal/domain"
+	"github.com/thetonbr/breezegate/internal/handlers"
+	"github.com/thetonbr/breezegate/internal/services"
+)
+
+const (
+	defaultReadTimeout  = 30 * time.Second
+	defaultWriteTimeout = 30 * time.Second
+	defaultHTTPSPort    = ":443"
+	defaultACMEStorage  = "acme"
+
+	defaultShutdownTimeout = 30 * time.Second
+	defaultReloadInterval  = 5 * time.Second
+	defaultDrainTimeout    = 5 * time.Minute
+
+	// affinityKeySize is the size of the generated key that signs affinity cookies.
+	affinityKeySize = 32
+)
+
+// Gateway holds the running state that configurations are applied to: the load balancer with its
+// backend servers, the certificates of the TLS domains and the listeners. Applying a configuration
+// builds the new routes off to the side and swaps them in at once, so requests never see a mix of
+// the old and the new configuration.
+type Gateway struct {
+	ctx              context.Context
+	lb               *domain.LoadBalancer
+	pool             *services.BackendPool
+	certStore        *services.CertificateStore
+	httpChallenge    *services.HTTPChallengeProvider
+	tlsALPNChallenge *services.TLSALPNChallengeProvider
+	renewer          *services.CertificateRenewer
+	acmeOpts         services.ACMEOptions
+	acmeStorage      services.Storage
+	affinityKey      []byte
+	hijacks          *handlers.HijackTracker
+	redirect         *handlers.HTTPSRedirectHandler
+	handler          http.Handler
+	tlsDomains       map[string]*tlsDomain
+	backendURLs      []string
+	httpServer       *http.Server
+	httpsServer      *http.Server
+	adminServer      *http.Server
+	current          config.Config
+	applied          bool
+	// applyMu serializes Apply, so the running state a new configuration is built from cannot change
+	// while it is built; mu guards the running state and is only held while it is swapped or read.
+	applyMu sync.Mutex
+	mu      sync.Mutex
+}
+
+// New creates the gateway for the initial configuration, which still has to be applied. Listener
+// ports and ACME settings are taken from it once; changing them later requires a restart. Health
+// checks and certificate renewals run until the context is canceled.
+func New(ctx context.Context, cfg config.Config) *Gateway {
+	gw := &Gateway{
+		ctx:           ctx,
+		lb:            domain.NewLoadBalancer(),
+		pool:          services.NewBackendPool(ctx, parseDuration(cfg.HealthCheckInterval, 0)),
+		certStore:     services.NewCertificateStore(),
+		httpChallenge: services.NewHTTPChallengeProvider(),
+		acmeOpts:      acmeOptions(cfg.ACME),
+		hijacks:       handlers.NewHijackTracker(),
+		tlsDomains:    make(map[string]*tlsDomain),
+		affinityKey:   make([]byte, affinityKeySize),
+	}
+	// Without a configured key, affinity cookies are signed with a key that lasts until the restart
+	if _, err := rand.Read(gw.affinityKey); err != nil {
+		log.Fatalf("Error generating affinity key: %s", err.Error())
+	}
+	gw.tlsALPNChallenge = services.NewTLSALPNChallengeProvider(gw.certStore)
+	gw.renewer = services.NewCertificateRenewer(gw.certStore, renewalOptions(cfg.ACME))
+
+	// Hijacked connections such as WebSockets are tracked so they can be drained on shutdown
+	gw.handler = gw.hijacks.Wrap(handlers.NewLoadBalancerHandler(gw.lb))
+	gw.redirect = handlers.NewHTTPSRedirectHandler(nil, httpsPort(cfg), redirectStatus(cfg), gw.handler)
+	return gw
+}
+
+// Apply makes the configuration the running one. The new routes are built and the certificates of
+// new TLS domains are set up first, then everything is swapped in at once; if anything fails, the
+// previous configuration stays in effect. Requests already being proxied finish on the backends they
+// were sent to, and the health checks of backends that are no longer used are stopped. Setting up
+// certificates may take a while, so the running configuration stays readable until the swap.
+func (g *Gateway) Apply(cfg config.Config) error {
+	g.applyMu.Lock()
+	defer g.applyMu.Unlock()
+	return g.apply(cfg)
+}
+
+// Update applies the result of editing a copy of the running configuration like Apply. Other
+// configurations wait until it is done, so no reload happens between reading and replacing the
+// running one. If edit fails, nothing is applied and its error is returned.
+func (g *Gateway) Update(edit func(cfg *config.Config) error) error {
+	g.applyMu.Lock()
+	defer g.applyMu.Unlock()
+	running := g.Config()
+	cfg := running.Clone()
+	if err := edit(&cfg); err != nil {
+		return err
+	}
+	return g.apply(cfg)
+}
+
+// apply implements Apply. The caller must hold applyMu.
+func (g *Gateway) apply(cfg config.Config) error {
+	if g.applied {
+		warnRestartRequired(g.current, cfg)
+	}
+
+	lb, healthChecks, err := g.buildLoadBalancer(cfg)
+	if err != nil {
+		g.pool.Retain(g.backendURLs)
+		return err
+	}
+	tlsDomains, err := g.startTLSDomains(cfg)
+	if err != nil {
+		g.pool.Retain(g.backendURLs)
+		return err
+	}
+
+	backendURLs := slices.Sorted(maps.Keys(healthChecks))
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.pool.SetInterval(parseDuration(cfg.HealthCheckInterval, 0))
+	g.pool.SetHealthChecks(healthChecks)
+	g.applyBackendSettings(cfg)
+	g.lb.Replace(lb)
+	g.pool.Retain(backendURLs)
+	g.backendURLs = backendURLs
+	g.replaceTLSDomains(tlsDomains)
+	g.redirect.SetHosts(httpsRedirectHosts(cfg))
+	g.certStore.SetDefault(cfg.DefaultCertificate)
+	g.current = cfg
+	g.applied = true
+
+	g.startListeners(cfg)
+	// Challenges can only be answered once the listeners are up
+	startRenewals(tlsDomains)
+	return nil
+}
+
+// Config returns the configuration that was applied last.
+func (g *Gateway) Config() config.Config {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.current
+}
+
+// servers returns the listeners that have been started.
+func (g *Gateway) servers() []*http.Server {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var servers []*http.Server
+	for _, server := range []*http.Server{g.httpsServer, g.httpServer, g.adminServer} {
+		if server != nil {
+			servers = append(servers, server)
+		}
+	}
+	return servers
+}
+
+// buildLoadBalancer creates a load balancer with the routes of every domain. Backend servers come
+// from the pool, so servers that were already running keep their health status. It also returns the
+// health check of every backend in use, which is only applied to the pool once the new routes are
+// swapped in.
+func (g *Gateway) buildLoadBalancer(
+	cfg config.Config,
+) (*domain.LoadBalancer, map[string]services.HealthCheckOptions, error) {
+	lb := domain.NewLoadBalancer()
+	healthChecks := make(map[string]services.HealthCheckOptions)
+
+	// Add routes and backend servers
+	for _, domainConfig := range cfg.Domains {
+		for _, route := range domainConfig.Routes {
+			var backends []*domain.Server
+			healthCheck := healthCheckOptions(route.HealthCheck)
+			for _, backend := range route.Backends {
+				server, err := g.pool.Prepare(backend.URL, startsUnhealthy(cfg.InitialHealth, backend))
+				if err != nil {
+					return nil, nil, fmt.Errorf("error creating server: %w", err)
+				}
+				backends = append(backends, server)
+				healthChecks[backend.URL] = healthCheck
+			}
+			opts, err := g.routeOptions(cfg, route)
+			if err != nil {
+				return nil, nil, fmt.Errorf("error adding route %s%s: %w", domainConfig.DomainName, route.Path, err)
+			}
+			err = lb.AddHostRouteWithOptions(
+				domainConfig.DomainName, route.Path, domain.MatchType(route.Match), opts, backends)
+			if err != nil {
+				return nil, nil, fmt.Errorf("error adding route %s%s: %w", domainConfig.DomainName, route.Path, err)
+			}
+		}
+		for _, alias := range domainConfig.Aliases {
+			lb.AddHostAlias(alias, domainConfig.DomainName)
+		}
+		if domainConfig.Default {
+			lb.SetDefaultHost(domainConfig.DomainName)
+		}
+	}
+	return lb, healthChecks, nil
+}
+
+// applyBackendSettings sets the administrative state and weight of every configured backend. Backends
+// whose state is unchanged are left alone, so a running drain is not restarted by a reload.
+// The caller must hold the lock.
+func (g *Gateway) applyBackendSettings(cfg config.Config) {
+	drainTimeout := parseDuration(cfg.DrainTimeout, defaultDrainTimeout)
+	for _, domainConfig := range cfg.Domains {
+		for _, route := range domainConfig.Routes {
+			for _, backend := range route.Backends {
+				server := g.pool.Lookup(backend.URL)
+				state, err := domain.ParseAdminState(backend.State)
+				if server == nil || err != nil {
+					continue
+				}
+				server.SetAdminState(state, drainTimeout)
+				server.SetWeight(backend.Weight)
+			}
+		}
+	}
+}
+
+// routeOptions creates the balancer that picks the backends of a route, its session affinity and its
+// outlier detection.
+func (g *Gateway) routeOptions(cfg config.Config, route config.Route) (domain.RouteOptions, error) {
+	var balancerOpts domain.BalancerOptions
+	if route.HashKey != nil {
+		key, err := domain.ParseHashKey(route.HashKey.Source, route.HashKey.Name)
+		if err != nil {
+			return domain.RouteOptions{}, err
+		}
+		balancerOpts.HashKey = key
+	}
+	balancer, err := domain.NewBalancer(domain.Algorithm(route.Algorithm), balancerOpts)
+	if err != nil {
+		return domain.RouteOptions{}, err
+	}
+
+	opts := domain.RouteOptions{Balancer: balancer}
+	if route.Affinity != nil {
+		key := g.affinityKey
+		if cfg.AffinityKey != "" {
+			key = []byte(cfg.AffinityKey)
+		}
+		opts.Affinity = domain.NewAffinity(affinityCookie(route.Affinity), key)
+	}
+	if detection := route.OutlierDetection; detection != nil {
+		opts.OutlierDetection = &domain.OutlierDetection{
+			ConsecutiveFailures: detection.ConsecutiveFailures,
+			FailurePercent:      detection.FailurePercent,
+			MinRequests:         detection.MinRequests,
+			Window:              parseDuration(detection.Window, 0),
+			BaseEjectionTime:    parseDuration(detection.BaseEjectionTime, 0),
+			MaxEjectionTime:     parseDuration(detection.MaxEjectionTime, 0),
+			MaxEjectionPercent:  detection.MaxEjectionPercent,
+		}
+	}
+	return opts, nil
+}
+
+// healthCheckOptions converts the health check configuration of a route into health check options.
+// The configuration has been validated, so it converts without errors.
+func healthCheckOptions(healthCheck *config.HealthCheck) services.HealthCheckOptions {
+	if healthCheck == nil {
+		return services.HealthCheckOptions{}
+	}
+	opts := services.HealthCheckOptions{
+		Type:               services.ProbeType(healthCheck.Type),
+		Service:            healthCheck.Service,
+		Command:            healthCheck.Command,
+		Path:               healthCheck.Path,
+		Method:             healthCheck.Method,
+		Host:               healthCheck.Host,
+		Headers:            healthCheck.Headers,
+		BodyContains:       healthCheck.BodyContains,
+		BodyRegex:          healthCheck.BodyRegex,
+		Timeout:            parseDuration(healthCheck.Timeout, 0),
+		Interval:           parseDuration(healthCheck.Interval, 0),
+		HealthyThreshold:   healthCheck.HealthyThreshold,
+		UnhealthyThreshold: healthCheck.UnhealthyThreshold,
+		MaxBackoff:         parseDuration(healthCheck.MaxBackoff, 0),
+	}
+	for _, status := range healthCheck.ExpectedStatus {
+		low, high, err := config.ParseStatusRange(status)
+		if err == nil {
+			opts.ExpectedStatus = append(opts.ExpectedStatus, services.StatusRange{Min: low, Max: high})
+		}
+	}
+	return opts
+}
+
+// startsUnhealthy reports whether a new server for the backend starts unhealthy in the given initial
+// health mode.
+func startsUnhealthy(initialHealth string, backend config.Backend) bool {
+	switch initialHealth {
+	case "unhealthy":
+		return true
+	case "config":
+		return !backend.Healthy
+	}
+	return false
+}
+
+// affinityCookie converts the affinity configuration of a route into cookie attributes.
+func affinityCookie(affinityConfig *config.Affinity) domain.AffinityCookie {
+	sameSite := http.SameSiteLaxMode
+	switch affinityConfig.SameSite {
+	case "strict":
+		sameSite = http.SameSiteStrictMode
+	case "none":
+		sameSite = http.SameSiteNoneMode
+	}
+	return domain.AffinityCookie{
+		Name:     affinityConfig.CookieName,
+		TTL:      parseDuration(affinityConfig.TTL, 0),
+		Secure:   affinityConfig.Secure,
+		HTTPOnly: affinityConfig.HTTPOnly,
+		SameSite: sameSite,
+	}
+}
+
+// startListeners starts the HTTPS listener once a TLS domain is configured and the plain HTTP
+// listener once any domain is. Both keep running across reloads. Their ports are bound before
+// startListeners returns, so ACME challenges sent to them afterwards are answered.
+// The caller must hold the lock.
+func (g *Gateway) startListeners(cfg config.Config) {
+	// Start a single HTTPS server for all TLS domains; certificates are selected by SNI
+	if g.httpsServer == nil && len(g.tlsDomains) > 0 {
+		g.httpsServer = handlers.NewTLSServer(httpsPort(cfg), g.certStore, g.handler)
+		listener := listen(g.httpsServer, "HTTPS")
+		go func(server *http.Server) {
+			log.Printf("Starting HTTPS server on port %s", server.Addr)
+			err := server.ServeTLS(listener, "", "")
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("Error starting HTTPS server: %s\n", err.Error())
+			}
+		}(g.httpsServer)
+	}
+
+	// Start a single HTTP server shared by all plain HTTP domains, HTTP-01 challenges and redirects
+	// to HTTPS; the handler routes by Host header
+	if g.httpServer == nil && len(cfg.Domains) > 0 {
+		g.httpServer = &http.Server{
+			Addr:         cfg.Port,
+			Handler:      handlers.NewACMEChallengeHandler(g.httpChallenge, g.redirect),
+			ReadTimeout:  defaultReadTimeout,
+			WriteTimeout: defaultWriteTimeout,
+		}
+		listener := listen(g.httpServer, "HTTP")
+		go func(server *http.Server) {
+			log.Printf("Starting HTTP server on port %s", server.Addr)
+			err := server.Serve(listener)
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("Error starting HTTP server: %s\n", err.Error())
+			}
+		}(g.httpServer)
+	}
+}
+
+// listen binds the port of a listener.
+func listen(server *http.Server, name string) net.Listener {
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		log.Fatalf("Error starting %s server: %s\n", name, err.Error())
+	}
+	return listener
+}
+
+// StartAdmin starts the admin API listener if the configuration has one. Configuration changes made
+// through the admin API are applied like a reload but are not written back to the configuration file.
+func (g *Gateway) StartAdmin(adminConfig *config.Admin) error {
+	if adminConfig == nil {
+		return nil
+	}
+	server, err := handlers.NewAdminServer(adminConfig, handlers.NewAdminHandler(g, g.pool, adminConfig.Token))
+	if err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	g.adminServer = server
+	g.mu.Unlock()
+	go func() {
+		log.Printf("Starting admin API on %s", server.Addr)
+		var serveErr error
+		if adminConfig.CertFile != "" {
+			serveErr = server.ListenAndServeTLS(adminConfig.CertFile, adminConfig.KeyFile)
+		} else {
+			serveErr = server.ListenAndServe()
+		}
+		if serveErr != nil && !errors.Is(serveErr, http.ErrServerClosed) {
+			log.Fatalf("Error starting admin API: %s\n", serveErr.Error())
+		}
+	}()
+	return nil
+}
+
+// Shutdown stops the listeners from accepting new connections and waits up to the shutdown timeout
+// of the running configuration for active requests and hijacked connections to finish. Connections
+// still open after the timeout are closed forcibly, and an error is returned.
+func (g *Gateway) Shutdown() error {
+	timeout := parseDuration(g.Config().ShutdownTimeout, defaultShutdownTimeout)
+	log.Printf("Shutting down, draining connections for up to %s", timeout)
+	return shutdown(g.servers(), g.hijacks, timeout)
+}
+
+// shutdown stops the servers from accepting new connections and waits for active requests and
+// hijacked connections to finish. Connections still open after the timeout are closed forcibly.
+func shutdown(servers []*http.Server, hijacks *handlers.HijackTracker, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	errs := make([]error, len(servers)+1)
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := server.Shutdown(ctx); err != nil {
+				errs[i] = fmt.Errorf("server %s: %w", server.Addr, err)
+				if closeErr := server.Close(); closeErr != nil {
+					log.Printf("Error closing server %s: %v", server.Addr, closeErr)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := hijacks.Drain(ctx); err != nil {
+		errs[len(servers)] = fmt.Errorf("hijacked connections: %w", err)
+	}
+	return errors.Join(errs...)
+}
+
+// warnRestartRequired logs the settings that differ between the running and the new configuration
+// but only take effect after a restart.
+func warnRestartRequired(running, next config.Config) {
+	settings := []struct {
+		name    string
+		changed bool
+	}{
+		{name: "port", changed: running.Port != next.Port},
+		{name: "httpsPort", changed: running.HTTPSPort != next.HTTPSPort},
+		{name: "redirectStatus", changed: running.RedirectStatus != next.RedirectStatus},
+		{name: "reloadInterval", changed: running.ReloadInterval != next.ReloadInterval},
+		{name: "acme", changed: !reflect.DeepEqual(running.ACME, next.ACME)},
+		{name: "admin", changed: !reflect.DeepEqual(running.Admin, next.Admin)},
+	}
+	for _, setting := range settings {
+		if setting.changed {
+			log.Printf("Configuration change of %s takes effect after a restart", setting.name)
+		}
+	}
+}
+
+// parseDuration parses an optional duration of the configuration, which has already been validated.
+func parseDuration(value string, fallback time.Duration) time.Duration {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return fallback
+	}
+	return duration
+}
@@ -0,0 +1,79 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/thetonbr/breezegate/internal/config"
+)
+
+// WatchConfig reloads the configuration file on SIGHUP and whenever its modification time or size
+// changes, checking at the reload interval of the running configuration. It blocks until the context
+// is canceled.
+func (g *Gateway) WatchConfig(ctx context.Context, file string) {
+	interval := parseDuration(g.Config().ReloadInterval, defaultReloadInterval)
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastInfo := statFile(file)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangups:
+			log.Printf("Received SIGHUP, reloading configuration from %s", file)
+		case <-ticker.C:
+			info, err := os.Stat(file)
+			if err != nil || !fileChanged(lastInfo, info) {
+				continue
+			}
+			log.Printf("Configuration file %s changed, reloading", file)
+		}
+
+		lastInfo = statFile(file)
+		if err := g.Reload(file); err != nil {
+			log.Printf("Keeping the running configuration: %s", err.Error())
+			continue
+		}
+		log.Printf("Configuration reloaded")
+	}
+}
+
+// statFile returns the file info of the configuration file, or nil if it cannot be read.
+func statFile(file string) os.FileInfo {
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil
+	}
+	return info
+}
+
+// Reload loads the configuration file and applies it. An invalid configuration is rejected and the
+// running one stays in effect.
+func (g *Gateway) Reload(file string) error {
+	cfg, err := config.LoadConfig(file)
+	if err != nil {
+		return fmt.Errorf("rejected configuration: %w", err)
+	}
+	if err = g.Apply(cfg); err != nil {
+		return fmt.Errorf("failed to apply configuration: %w", err)
+	}
+	return nil
+}
+
+// fileChanged reports whether a file's modification time or size differs from an earlier state.
+func fileChanged(before, after os.FileInfo) bool {
+	if before == nil {
+		return true
+	}
+	return !before.ModTime().Equal(after.ModTime()) || before.Size() != after.Size()
+}
@@ -0,0 +1,267 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"path/filepath"
+	"reflect"
+
+	"github.com/go-acme/lego/v4/challenge"
+	"github.com/go-acme/lego/v4/lego"
+
+	"github.com/thetonbr/breezegate/internal/config"
+	"github.com/thetonbr/breezegate/internal/services"
+)
+
+// tlsDomain is a TLS domain whose certificate is kept up to date in the certificate store, either
+// by an ACME renewer or by watching its certificate files.
+type tlsDomain struct {
+	settings config.Domain
+	names    []string
+	stop     context.CancelFunc
+	// renew starts the ACME renewer of the certificate; it is nil for certificates from files and once
+	// the renewer runs.
+	renew func()
+}
+
+// tlsSettings returns the parts of a domain's configuration that affect its certificate.
+func tlsSettings(domainConfig config.Domain) config.Domain {
+	domainConfig.Routes = nil
+	domainConfig.AllowHTTP = false
+	domainConfig.Default = false
+	return domainConfig
+}
+
+// startTLSDomains returns the TLS domains of the configuration, reusing the running ones whose
+// certificate settings are unchanged and starting the others. If one cannot be started, those
+// started so far are stopped again.
+// The caller must hold applyMu.
+func (g *Gateway) startTLSDomains(cfg config.Config) (map[string]*tlsDomain, error) {
+	next := make(map[string]*tlsDomain)
+	var started []*tlsDomain
+	for _, domainConfig := range cfg.Domains {
+		if !domainConfig.UseTLS {
+			continue
+		}
+		if running, exists := g.tlsDomains[domainConfig.DomainName]; exists &&
+			reflect.DeepEqual(running.settings, tlsSettings(domainConfig)) {
+			next[domainConfig.DomainName] = running
+			continue
+		}
+
+		td, err := g.startTLSDomain(cfg, domainConfig)
+		if err != nil {
+			for _, startedDomain := range started {
+				startedDomain.stop()
+			}
+			return nil, err
+		}
+		started = append(started, td)
+		next[domainConfig.DomainName] = td
+	}
+	return next, nil
+}
+
+// replaceTLSDomains stops the running TLS domains that are not part of next and removes their
+// certificates from the store unless another domain now serves the same name.
+// The caller must hold the lock.
+func (g *Gateway) replaceTLSDomains(next map[string]*tlsDomain) {
+	served := make(map[string]bool)
+	for _, td := range next {
+		for _, name := range td.names {
+			served[name] = true
+		}
+	}
+	for name, running := range g.tlsDomains {
+		if next[name] == running {
+			continue
+		}
+		running.stop()
+		for _, certName := range running.names {
+			if !served[certName] {
+				g.certStore.Remove(certName)
+			}
+		}
+	}
+	g.tlsDomains = next
+}
+
+// startTLSDomain creates an ACME client for the domain that renews its certificate into the
+// certificate store once startRenewals is called, or loads the domain's certificate files and
+// watches them for changes.
+// The caller must hold applyMu.
+func (g *Gateway) startTLSDomain(cfg config.Config, domainConfig config.Domain) (*tlsDomain, error) {
+	ctx, cancel := context.WithCancel(g.ctx)
+	td := &tlsDomain{
+		settings: tlsSettings(domainConfig),
+		names:    append([]string{domainConfig.DomainName}, domainConfig.Aliases...),
+		stop:     cancel,
+	}
+
+	// Certificates from files are kept up to date by reloading them instead of through ACME
+	if domainConfig.CertFile != "" {
+		files := services.CertificateFiles{
+			CertFile: domainConfig.CertFile,
+			KeyFile:  domainConfig.KeyFile,
+			CAFile:   domainConfig.CAFile,
+		}
+		watcher := services.NewCertificateFileWatcher(g.certStore, td.names, files, 0)
+		if err := watcher.Load(); err != nil {
+			cancel()
+			return nil, fmt.Errorf("error loading certificate for %s: %w", domainConfig.DomainName, err)
+		}
+		go watcher.Watch(ctx)
+		return td, nil
+	}
+
+	acmeClient, err := g.newACMEClient(cfg, domainConfig)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("error configuring ACME for %s: %w", domainConfig.DomainName, err)
+	}
+	// Reuse a stored certificate so it is only reissued when it is due for renewal
+	if cert, loadErr := g.acmeStorage.LoadCertificate(domainConfig.DomainName); loadErr == nil {
+		g.certStore.PutAll(td.names, cert)
+	} else if !errors.Is(loadErr, fs.ErrNotExist) {
+		log.Printf("Ignoring stored certificate for %s: %s", domainConfig.DomainName, loadErr.Error())
+	}
+	// The renewer issues one certificate for all names of the domain and keeps it renewed. It is
+	// started by startRenewals, since its challenges need the listeners.
+	td.renew = func() { go g.renewer.Watch(ctx, td.names, acmeClient) }
+	return td, nil
+}
+
+// startRenewals starts the ACME renewers of the TLS domains that do not run yet.
+// The caller must hold the lock.
+func startRenewals(tlsDomains map[string]*tlsDomain) {
+	for _, td := range tlsDomains {
+		if td.renew != nil {
+			td.renew()
+			td.renew = nil
+		}
+	}
+}
+
+// newACMEClient creates the ACME client of a domain with the challenge provider it is configured for.
+// The caller must hold applyMu.
+func (g *Gateway) newACMEClient(cfg config.Config, domainConfig config.Domain) (*services.ACMEClient, error) {
+	if g.acmeStorage == nil {
+		storage, err := newACMEStorage(cfg.ACME)
+		if err != nil {
+			return nil, err
+		}
+		g.acmeStorage = storage
+	}
+
+	challengeType, err := services.ParseChallengeType(domainConfig.Challenge)
+	if err != nil {
+		return nil, err
+	}
+	opts := g.acmeOpts
+	opts.Challenge = challengeType
+	switch challengeType {
+	case services.ChallengeHTTP01:
+		opts.Provider = g.httpChallenge
+	case services.ChallengeTLSALPN01:
+		opts.Provider = g.tlsALPNChallenge
+	case services.ChallengeDNS01:
+		opts.Provider, err = newDNSProvider(cfg.ACME, domainConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return services.NewACMEClient(domainConfig.Email, g.acmeStorage, opts)
+}
+
+// httpsRedirectHosts returns the names of all TLS domains whose plain HTTP requests are redirected to HTTPS.
+func httpsRedirectHosts(cfg config.Config) []string {
+	var hosts []string
+	for _, domainConfig := range cfg.Domains {
+		if domainConfig.UseTLS && !domainConfig.AllowHTTP {
+			hosts = append(hosts, domainConfig.DomainName)
+			hosts = append(hosts, domainConfig.Aliases...)
+		}
+	}
+	return hosts
+}
+
+// httpsPort returns the address of the HTTPS listener.
+func httpsPort(cfg config.Config) string {
+	if cfg.HTTPSPort == "" {
+		return defaultHTTPSPort
+	}
+	return cfg.HTTPSPort
+}
+
+// redirectStatus returns the status code of redirects to HTTPS, 301 unless configured otherwise.
+func redirectStatus(cfg config.Config) int {
+	if cfg.RedirectStatus == 0 {
+		return http.StatusMovedPermanently
+	}
+	return cfg.RedirectStatus
+}
+
+// acmeOptions converts the CA settings of the ACME configuration into ACME client options.
+func acmeOptions(acmeConfig config.ACME) services.ACMEOptions {
+	keyType, err := services.ParseKeyType(acmeConfig.KeyType)
+	if err != nil {
+		log.Fatalf("Error parsing ACME keyType: %s", err.Error())
+	}
+	opts := services.ACMEOptions{
+		DirectoryURL: acmeConfig.DirectoryURL,
+		KeyType:      keyType,
+		RenewBefore:  parseDuration(acmeConfig.RenewBefore, 0),
+	}
+	if len(acmeConfig.CACertificates) > 0 {
+		opts.RootCAs, err = lego.CreateCertPool(acmeConfig.CACertificates, true)
+		if err != nil {
+			log.Fatalf("Error loading ACME caCertificates: %s", err.Error())
+		}
+	}
+	if acmeConfig.EAB != nil {
+		opts.EAB = &services.ExternalAccountBinding{
+			KeyID:   acmeConfig.EAB.KeyID,
+			HMACKey: acmeConfig.EAB.HMACKey,
+		}
+	}
+	return opts
+}
+
+// renewalOptions converts the ACME configuration into certificate renewal options.
+func renewalOptions(acmeConfig config.ACME) services.RenewalOptions {
+	return services.RenewalOptions{
+		RenewBefore:   parseDuration(acmeConfig.RenewBefore, 0),
+		CheckInterval: parseDuration(acmeConfig.RenewCheckInterval, 0),
+	}
+}
+
+// newDNSProvider creates the DNS-01 provider for a domain, preferring the domain's own provider
+// configuration over the global one.
+func newDNSProvider(acmeConfig config.ACME, domainConfig config.Domain) (challenge.Provider, error) {
+	providerConfig := domainConfig.DNSProvider
+	if providerConfig == nil {
+		providerConfig = acmeConfig.DNSProvider
+	}
+	if providerConfig == nil {
+		providerConfig = &config.DNSProvider{}
+	}
+	return services.NewDNSProvider(providerConfig.Name, providerConfig.Options)
+}
+
+// newACMEStorage opens the filesystem storage for ACME accounts and certificates. Every CA gets its
+// own subdirectory, so switching between staging and production never mixes their data.
+func newACMEStorage(acmeConfig config.ACME) (services.Storage, error) {
+	dir := acmeConfig.StorageDir
+	if dir == "" {
+		dir = defaultACMEStorage
+	}
+	storage, err := services.NewFileStorage(filepath.Join(dir, services.StorageNamespace(acmeConfig.DirectoryURL)))
+	if err != nil {
+		return nil, fmt.Errorf("error opening ACME storage: %w", err)
+	}
+	return storage, nil
+}
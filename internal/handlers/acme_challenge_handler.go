@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/thetonbr/breezegate/internal/services"
+)
+
+// ACMEChallengePathPrefix is the path under which ACME HTTP-01 challenge tokens are served.
+const ACMEChallengePathPrefix = "/.well-known/acme-challenge/"
+
+// ACMEChallengeHandler answers the ACME HTTP-01 challenges pending in its provider and passes every
+// other request, including ones for unknown tokens, to the next handler.
+type ACMEChallengeHandler struct {
+	provider *services.HTTPChallengeProvider
+	next     http.Handler
+}
+
+// NewACMEChallengeHandler creates a new instance of ACMEChallengeHandler.
+func NewACMEChallengeHandler(provider *services.HTTPChallengeProvider, next http.Handler) *ACMEChallengeHandler {
+	return &ACMEChallengeHandler{provider: provider, next: next}
+}
+
+// ServeHTTP implements the HTTP handler interface.
+func (h *ACMEChallengeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Only tokens of pending challenges are answered; other paths below the prefix may belong to a
+	// backend that runs its own ACME client
+	if token, isChallenge := strings.CutPrefix(r.URL.Path, ACMEChallengePathPrefix); isChallenge {
+		if keyAuth, exists := h.provider.KeyAuthorization(token); exists {
+			w.Header().Set("Content-Type", "text/plain")
+			if _, err := w.Write([]byte(keyAuth)); err != nil {
+				log.Printf("Error writing challenge response: %v", err)
+			}
+			return
+		}
+	}
+	h.next.ServeHTTP(w, r)
+}
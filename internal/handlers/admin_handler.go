@@ -0,0 +1,510 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/thetonbr/breezegate/internal/config"
+	"github.com/thetonbr/breezegate/internal/domain"
+	"github.com/thetonbr/breezegate/internal/services"
+)
+
+const (
+	adminReadTimeout  = 10 * time.Second
+	adminWriteTimeout = 30 * time.Second
+	adminMaxBodyBytes = 1 << 20
+
+	// redacted replaces credentials in configuration dumps.
+	redacted = "REDACTED"
+)
+
+// RuntimeConfig is the running configuration that the admin API inspects and changes.
+type RuntimeConfig interface {
+	// Config returns the configuration that is in effect.
+	Config() config.Config
+	// Update calls edit with a copy of the running configuration and makes the edited copy the
+	// running one unless edit returns an error. No other configuration is applied in between, so
+	// concurrent reloads and edits never overwrite each other.
+	Update(edit func(cfg *config.Config) error) error
+}
+
+// errNotFound is returned by configuration edits that refer to a missing domain, route or backend.
+var errNotFound = errors.New("not found")
+
+// AdminHandler serves the admin REST API. Changes to domains, routes and backends are made to a copy
+// of the running configuration, which is validated like a configuration file and then applied the
+// same way a reload is, and so are backend state changes. Forced health status acts on the running
+// backend servers directly.
+type AdminHandler struct {
+	runtime RuntimeConfig
+	pool    *services.BackendPool
+	token   string
+	mux     *http.ServeMux
+}
+
+// backendStatus describes a running backend server.
+type backendStatus struct {
+	URL          string `json:"url"`
+	Healthy      bool   `json:"healthy"`
+	HealthForced bool   `json:"healthForced"`
+	State        string `json:"state"`
+	Weight       int    `json:"weight"`
+	InFlight     int64  `json:"inFlight"`
+	Drained      bool   `json:"drained"`
+	Ejected      bool   `json:"ejected"`
+}
+
+// backendRequest selects a backend server and optionally a weight or a health status to force; a null
+// health status lets health checks decide again.
+type backendRequest struct {
+	URL     string `json:"url"`
+	Weight  int    `json:"weight,omitempty"`
+	Healthy *bool  `json:"healthy"`
+}
+
+// NewAdminHandler creates the admin API. If token is not empty, every request must carry it as a
+// bearer token in the Authorization header.
+func NewAdminHandler(runtime RuntimeConfig, pool *services.BackendPool, token string) *AdminHandler {
+	h := &AdminHandler{runtime: runtime, pool: pool, token: token, mux: http.NewServeMux()}
+
+	h.mux.HandleFunc("GET /config", h.getConfig)
+	h.mux.HandleFunc("GET /domains", h.listDomains)
+	h.mux.HandleFunc("POST /domains", h.addDomain)
+	h.mux.HandleFunc("GET /domains/{domain}", h.getDomain)
+	h.mux.HandleFunc("PUT /domains/{domain}", h.updateDomain)
+	h.mux.HandleFunc("DELETE /domains/{domain}", h.deleteDomain)
+	h.mux.HandleFunc("POST /domains/{domain}/routes", h.addRoute)
+	h.mux.HandleFunc("PUT /domains/{domain}/routes", h.updateRoute)
+	h.mux.HandleFunc("DELETE /domains/{domain}/routes", h.deleteRoute)
+	h.mux.HandleFunc("POST /domains/{domain}/routes/backends", h.addBackend)
+	h.mux.HandleFunc("DELETE /domains/{domain}/routes/backends", h.deleteBackend)
+	h.mux.HandleFunc("GET /backends", h.listBackends)
+	h.mux.HandleFunc("POST /backends/drain", h.setBackendState(domain.StateDraining))
+	h.mux.HandleFunc("POST /backends/undrain", h.setBackendState(domain.StateActive))
+	h.mux.HandleFunc("POST /backends/disable", h.setBackendState(domain.StateDisabled))
+	h.mux.HandleFunc("PUT /backends/weight", h.setBackendWeight)
+	h.mux.HandleFunc("PUT /backends/health", h.forceHealth)
+	return h
+}
+
+// NewAdminServer creates the admin listener. With a certificate it serves HTTPS, and with a client CA
+// it only accepts clients that present a certificate signed by that CA.
+func NewAdminServer(adminConfig *config.Admin, handler http.Handler) (*http.Server, error) {
+	server := &http.Server{
+		Addr:         adminConfig.Address,
+		Handler:      handler,
+		ReadTimeout:  adminReadTimeout,
+		WriteTimeout: adminWriteTimeout,
+	}
+	if adminConfig.ClientCAFile == "" {
+		return server, nil
+	}
+
+	caPEM, err := os.ReadFile(adminConfig.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read admin client CA: %w", err)
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in %s", adminConfig.ClientCAFile)
+	}
+	server.TLSConfig = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+		MinVersion: tls.VersionTLS12,
+	}
+	return server, nil
+}
+
+// ServeHTTP implements the HTTP handler interface.
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.token != "" {
+		token, hasToken := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !hasToken || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, adminMaxBodyBytes)
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *AdminHandler) getConfig(w http.ResponseWriter, _ *http.Request) {
+	cfg := h.redactedConfig()
+	writeJSON(w, http.StatusOK, &cfg)
+}
+
+func (h *AdminHandler) listDomains(w http.ResponseWriter, _ *http.Request) {
+	cfg := h.redactedConfig()
+	domains := cfg.Domains
+	if domains == nil {
+		domains = []config.Domain{}
+	}
+	writeJSON(w, http.StatusOK, domains)
+}
+
+func (h *AdminHandler) getDomain(w http.ResponseWriter, r *http.Request) {
+	cfg := h.redactedConfig()
+	i := findDomain(&cfg, r.PathValue("domain"))
+	if i < 0 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("domain %q %w", r.PathValue("domain"), errNotFound))
+		return
+	}
+	writeJSON(w, http.StatusOK, cfg.Domains[i])
+}
+
+func (h *AdminHandler) addDomain(w http.ResponseWriter, r *http.Request) {
+	var domainConfig config.Domain
+	if !readJSON(w, r, &domainConfig) {
+		return
+	}
+	h.edit(w, http.StatusCreated, domainConfig, func(cfg *config.Config) error {
+		cfg.Domains = append(cfg.Domains, domainConfig)
+		return nil
+	})
+}
+
+func (h *AdminHandler) updateDomain(w http.ResponseWriter, r *http.Request) {
+	var domainConfig config.Domain
+	if !readJSON(w, r, &domainConfig) {
+		return
+	}
+	if domainConfig.DomainName == "" {
+		domainConfig.DomainName = r.PathValue("domain")
+	}
+	h.edit(w, http.StatusOK, domainConfig, func(cfg *config.Config) error {
+		i := findDomain(cfg, r.PathValue("domain"))
+		if i < 0 {
+			return fmt.Errorf("domain %q %w", r.PathValue("domain"), errNotFound)
+		}
+		// A domain read from this API has its credentials redacted; keep the running ones
+		running := cfg.Domains[i].DNSProvider
+		cfg.Domains[i] = domainConfig
+		cfg.Domains[i].DNSProvider = restoreRedacted(domainConfig.DNSProvider, running)
+		return nil
+	})
+}
+
+func (h *AdminHandler) deleteDomain(w http.ResponseWriter, r *http.Request) {
+	h.edit(w, http.StatusNoContent, nil, func(cfg *config.Config) error {
+		i := findDomain(cfg, r.PathValue("domain"))
+		if i < 0 {
+			return fmt.Errorf("domain %q %w", r.PathValue("domain"), errNotFound)
+		}
+		cfg.Domains = slices.Delete(cfg.Domains, i, i+1)
+		return nil
+	})
+}
+
+func (h *AdminHandler) addRoute(w http.ResponseWriter, r *http.Request) {
+	var route config.Route
+	if !readJSON(w, r, &route) {
+		return
+	}
+	h.editDomain(w, r, http.StatusCreated, route, func(domainConfig *config.Domain) error {
+		domainConfig.Routes = append(domainConfig.Routes, route)
+		return nil
+	})
+}
+
+func (h *AdminHandler) updateRoute(w http.ResponseWriter, r *http.Request) {
+	var route config.Route
+	if !readJSON(w, r, &route) {
+		return
+	}
+	h.editRoute(w, r, http.StatusOK, route, func(domainConfig *config.Domain, i int) error {
+		domainConfig.Routes[i] = route
+		return nil
+	})
+}
+
+func (h *AdminHandler) deleteRoute(w http.ResponseWriter, r *http.Request) {
+	h.editRoute(w, r, http.StatusNoContent, nil, func(domainConfig *config.Domain, i int) error {
+		domainConfig.Routes = slices.Delete(domainConfig.Routes, i, i+1)
+		return nil
+	})
+}
+
+func (h *AdminHandler) addBackend(w http.ResponseWriter, r *http.Request) {
+	var backend config.Backend
+	if !readJSON(w, r, &backend) {
+		return
+	}
+	h.editRoute(w, r, http.StatusCreated, backend, func(domainConfig *config.Domain, i int) error {
+		domainConfig.Routes[i].Backends = append(domainConfig.Routes[i].Backends, backend)
+		return nil
+	})
+}
+
+func (h *AdminHandler) deleteBackend(w http.ResponseWriter, r *http.Request) {
+	backendURL := r.URL.Query().Get("url")
+	h.editRoute(w, r, http.StatusNoContent, nil, func(domainConfig *config.Domain, i int) error {
+		backends := domainConfig.Routes[i].Backends
+		j := slices.IndexFunc(backends, func(backend config.Backend) bool { return backend.URL == backendURL })
+		if j < 0 {
+			return fmt.Errorf("backend %q %w", backendURL, errNotFound)
+		}
+		domainConfig.Routes[i].Backends = slices.Delete(backends, j, j+1)
+		return nil
+	})
+}
+
+func (h *AdminHandler) listBackends(w http.ResponseWriter, _ *http.Request) {
+	servers := h.pool.Servers()
+	statuses := make([]backendStatus, 0, len(servers))
+	for _, server := range servers {
+		statuses = append(statuses, newBackendStatus(server))
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// setBackendState changes the state of a backend wherever it is used in the configuration.
+func (h *AdminHandler) setBackendState(state domain.AdminState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.editBackend(w, r, func(backend *config.Backend, _ backendRequest) {
+			backend.State = string(state)
+		})
+	}
+}
+
+func (h *AdminHandler) setBackendWeight(w http.ResponseWriter, r *http.Request) {
+	h.editBackend(w, r, func(backend *config.Backend, req backendRequest) {
+		backend.Weight = req.Weight
+	})
+}
+
+// editBackend reads a backendRequest and changes the backend it names wherever it is used in the
+// configuration, so the change is validated and applied like any other edit. It responds with the
+// status of the running server.
+func (h *AdminHandler) editBackend(
+	w http.ResponseWriter, r *http.Request, change func(backend *config.Backend, req backendRequest),
+) {
+	var req backendRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	applied := h.applyEdit(w, func(cfg *config.Config) error {
+		found := false
+		for i := range cfg.Domains {
+			for j := range cfg.Domains[i].Routes {
+				backends := cfg.Domains[i].Routes[j].Backends
+				for k := range backends {
+					if backends[k].URL == req.URL {
+						change(&backends[k], req)
+						found = true
+					}
+				}
+			}
+		}
+		if !found {
+			return fmt.Errorf("backend %q %w", req.URL, errNotFound)
+		}
+		return nil
+	})
+	if !applied {
+		return
+	}
+	if server := h.pool.Lookup(req.URL); server != nil {
+		writeJSON(w, http.StatusOK, newBackendStatus(server))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AdminHandler) forceHealth(w http.ResponseWriter, r *http.Request) {
+	server, req, ok := h.lookupBackend(w, r)
+	if !ok {
+		return
+	}
+	if req.Healthy == nil {
+		server.ClearForcedHealthStatus()
+	} else {
+		server.ForceHealthStatus(*req.Healthy)
+	}
+	writeJSON(w, http.StatusOK, newBackendStatus(server))
+}
+
+// lookupBackend reads a backendRequest and returns the running server it names.
+func (h *AdminHandler) lookupBackend(w http.ResponseWriter, r *http.Request) (*domain.Server, backendRequest, bool) {
+	var req backendRequest
+	if !readJSON(w, r, &req) {
+		return nil, req, false
+	}
+	server := h.pool.Lookup(req.URL)
+	if server == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("backend %q %w", req.URL, errNotFound))
+		return nil, req, false
+	}
+	return server, req, true
+}
+
+// redactedConfig returns a copy of the running configuration with credentials replaced.
+func (h *AdminHandler) redactedConfig() config.Config {
+	running := h.runtime.Config()
+	cfg := running.Clone()
+	if cfg.Admin != nil && cfg.Admin.Token != "" {
+		cfg.Admin.Token = redacted
+	}
+	if cfg.AffinityKey != "" {
+		cfg.AffinityKey = redacted
+	}
+	if cfg.ACME.EAB != nil {
+		cfg.ACME.EAB.HMACKey = redacted
+	}
+	redactDNSProvider(cfg.ACME.DNSProvider)
+	for i := range cfg.Domains {
+		redactDNSProvider(cfg.Domains[i].DNSProvider)
+	}
+	return cfg
+}
+
+// redactDNSProvider replaces the values of options that hold credentials.
+func redactDNSProvider(provider *config.DNSProvider) {
+	if provider == nil {
+		return
+	}
+	for name := range provider.Options {
+		lower := strings.ToLower(name)
+		if strings.Contains(lower, "key") || strings.Contains(lower, "secret") || strings.Contains(lower, "token") {
+			provider.Options[name] = redacted
+		}
+	}
+}
+
+// restoreRedacted returns a copy of provider whose redacted option values are replaced with the
+// values of the running provider.
+func restoreRedacted(provider, running *config.DNSProvider) *config.DNSProvider {
+	if provider == nil || running == nil {
+		return provider
+	}
+	restored := &config.DNSProvider{Name: provider.Name, Options: make(map[string]string, len(provider.Options))}
+	for name, value := range provider.Options {
+		if value == redacted {
+			value = running.Options[name]
+		}
+		restored.Options[name] = value
+	}
+	return restored
+}
+
+// edit applies a change to a copy of the running configuration, validates the result and applies it.
+// On success it responds with the given status and body.
+func (h *AdminHandler) edit(w http.ResponseWriter, status int, body any, change func(cfg *config.Config) error) {
+	if !h.applyEdit(w, change) {
+		return
+	}
+	if body == nil {
+		w.WriteHeader(status)
+		return
+	}
+	writeJSON(w, status, body)
+}
+
+// applyEdit applies a change to a copy of the running configuration, validates the result and applies
+// it. If any step fails, it responds with an error and returns false.
+func (h *AdminHandler) applyEdit(w http.ResponseWriter, change func(cfg *config.Config) error) bool {
+	var editErr error
+	err := h.runtime.Update(func(cfg *config.Config) error {
+		if editErr = change(cfg); editErr != nil {
+			return editErr
+		}
+		if validateErr := cfg.Validate(); validateErr != nil {
+			editErr = fmt.Errorf("invalid configuration: %w", validateErr)
+		}
+		return editErr
+	})
+	switch {
+	case errors.Is(editErr, errNotFound):
+		writeError(w, http.StatusNotFound, editErr)
+	case editErr != nil:
+		writeError(w, http.StatusBadRequest, editErr)
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+	default:
+		return true
+	}
+	return false
+}
+
+// editDomain edits the domain named in the request path.
+func (h *AdminHandler) editDomain(
+	w http.ResponseWriter, r *http.Request, status int, body any, change func(domainConfig *config.Domain) error,
+) {
+	name := r.PathValue("domain")
+	h.edit(w, status, body, func(cfg *config.Config) error {
+		i := findDomain(cfg, name)
+		if i < 0 {
+			return fmt.Errorf("domain %q %w", name, errNotFound)
+		}
+		return change(&cfg.Domains[i])
+	})
+}
+
+// editRoute edits the route whose path is given by the path query parameter.
+func (h *AdminHandler) editRoute(
+	w http.ResponseWriter, r *http.Request, status int, body any,
+	change func(domainConfig *config.Domain, i int) error,
+) {
+	path := r.URL.Query().Get("path")
+	h.editDomain(w, r, status, body, func(domainConfig *config.Domain) error {
+		i := slices.IndexFunc(domainConfig.Routes, func(route config.Route) bool { return route.Path == path })
+		if i < 0 {
+			return fmt.Errorf("route %q %w", path, errNotFound)
+		}
+		return change(domainConfig, i)
+	})
+}
+
+// findDomain returns the index of the domain with the given name, or -1.
+func findDomain(cfg *config.Config, name string) int {
+	return slices.IndexFunc(cfg.Domains, func(domainConfig config.Domain) bool {
+		return strings.EqualFold(domainConfig.DomainName, name)
+	})
+}
+
+func newBackendStatus(server *domain.Server) backendStatus {
+	return backendStatus{
+		URL:          server.URL.String(),
+		Healthy:      server.GetHealthStatus(),
+		HealthForced: server.IsHealthForced(),
+		State:        string(server.AdminState()),
+		Weight:       server.Weight(),
+		InFlight:     server.InFlight(),
+		Drained:      server.IsDrained(),
+		Ejected:      server.IsEjected(),
+	}
+}
+
+// readJSON decodes the request body, responding with 400 if it is not valid JSON.
+func readJSON(w http.ResponseWriter, r *http.Request, target any) bool {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(target); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Error writing admin response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
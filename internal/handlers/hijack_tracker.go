@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const hijackDrainPollInterval = 100 * time.Millisecond
+
+// HijackTracker keeps track of connections hijacked from the HTTP servers, such as proxied WebSocket
+// upgrades. http.Server.Shutdown neither waits for nor closes hijacked connections, so they are
+// drained separately.
+type HijackTracker struct {
+	conns map[*trackedConn]struct{}
+	mu    sync.Mutex
+}
+
+// NewHijackTracker creates a new instance of HijackTracker.
+func NewHijackTracker() *HijackTracker {
+	return &HijackTracker{conns: make(map[*trackedConn]struct{})}
+}
+
+// Wrap returns a handler that records every connection hijacked by next.
+func (t *HijackTracker) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&hijackTrackingWriter{ResponseWriter: w, tracker: t}, r)
+	})
+}
+
+// Len returns the number of hijacked connections that are still open.
+func (t *HijackTracker) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.conns)
+}
+
+// Drain waits until all hijacked connections are closed. If the context ends first, the remaining
+// connections are closed forcibly and the context's error is returned.
+func (t *HijackTracker) Drain(ctx context.Context) error {
+	ticker := time.NewTicker(hijackDrainPollInterval)
+	defer ticker.Stop()
+	for t.Len() > 0 {
+		select {
+		case <-ctx.Done():
+			t.closeAll()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+func (t *HijackTracker) closeAll() {
+	t.mu.Lock()
+	conns := make([]*trackedConn, 0, len(t.conns))
+	for conn := range t.conns {
+		conns = append(conns, conn)
+	}
+	t.mu.Unlock()
+	for _, conn := range conns {
+		if err := conn.Close(); err != nil {
+			log.Printf("Error closing hijacked connection: %v", err)
+		}
+	}
+}
+
+func (t *HijackTracker) add(conn net.Conn) net.Conn {
+	tracked := &trackedConn{Conn: conn, tracker: t}
+	t.mu.Lock()
+	t.conns[tracked] = struct{}{}
+	t.mu.Unlock()
+	return tracked
+}
+
+func (t *HijackTracker) remove(conn *trackedConn) {
+	t.mu.Lock()
+	delete(t.conns, conn)
+	t.mu.Unlock()
+}
+
+// trackedConn removes itself from its tracker when closed.
+type trackedConn struct {
+	net.Conn
+	tracker *HijackTracker
+	once    sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(func() { c.tracker.remove(c) })
+	return c.Conn.Close()
+}
+
+// hijackTrackingWriter hands hijacked connections to its tracker. Other optional interfaces, such as
+// flushing, are reached through Unwrap by http.ResponseController.
+type hijackTrackingWriter struct {
+	http.ResponseWriter
+	tracker *HijackTracker
+}
+
+func (w *hijackTrackingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	return w.tracker.add(conn), rw, nil
+}
+
+func (w *hijackTrackingWriter) Flush() {
+	_ = http.NewResponseController(w.ResponseWriter).Flush() //nolint:errcheck // http.Flusher cannot report errors
+}
+
+func (w *hijackTrackingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/thetonbr/breezegate/internal/domain"
+)
+
+const defaultHTTPSPortNumber = "443"
+
+// HTTPSRedirectHandler redirects plain HTTP requests for TLS hosts to HTTPS, keeping their path and
+// query, and passes requests for every other host to the next handler.
+type HTTPSRedirectHandler struct {
+	hosts     []string
+	httpsPort string
+	status    int
+	next      http.Handler
+	mu        sync.RWMutex
+}
+
+// NewHTTPSRedirectHandler creates a handler that redirects requests for the given host names, which
+// may be wildcards, to the HTTPS listener on httpsAddr using the given status code, e.g.
+// http.StatusMovedPermanently or http.StatusPermanentRedirect.
+func NewHTTPSRedirectHandler(hosts []string, httpsAddr string, status int, next http.Handler) *HTTPSRedirectHandler {
+	_, port, err := net.SplitHostPort(httpsAddr)
+	if err != nil || port == defaultHTTPSPortNumber {
+		port = ""
+	}
+	return &HTTPSRedirectHandler{hosts: hosts, httpsPort: port, status: status, next: next}
+}
+
+// SetHosts replaces the host names that are redirected, e.g. after a configuration reload.
+func (h *HTTPSRedirectHandler) SetHosts(hosts []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.hosts = hosts
+}
+
+// ServeHTTP implements the HTTP handler interface.
+func (h *HTTPSRedirectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.redirects(r.Host) {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	host := r.Host
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	if h.httpsPort != "" {
+		host = net.JoinHostPort(host, h.httpsPort)
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), h.status)
+}
+
+func (h *HTTPSRedirectHandler) redirects(host string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return slices.ContainsFunc(h.hosts, func(pattern string) bool { return domain.MatchHost(pattern, host) })
+}
@@ -4,6 +4,7 @@ Package handlers contains HTTP handlers for the load balancer, including routing
 package handlers
 
 import (
+	"log"
 	"net/http"
 
 	"github.com/thetonbr/breezegate/internal/domain"
@@ -20,22 +21,56 @@ func NewLoadBalancerHandler(lb *domain.LoadBalancer) *LoadBalancerHandler {
 }
 
 // ServeHTTP implements the HTTP handler interface. It routes the request to the appropriate backend
-// based on the URL path.
+// based on the Host header first and the URL path second.
 func (h *LoadBalancerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Route and proxy the cleaned path, so dot segments cannot reach a backend through another route
+	if cleaned := domain.CleanPath(r.URL.Path); cleaned != r.URL.Path {
+		r = r.Clone(r.Context())
+		r.URL.Path, r.URL.RawPath = cleaned, ""
+	}
+
 	// Extract the URL path
 	path := r.URL.Path
 
-	// Find the appropriate backend for the path
-	server := h.lb.GetBackendForPath(path)
+	// Find the appropriate backend for the host and path; the route's balancer sees the whole request
+	server, affinityCookie := h.lb.SelectBackend(r)
 	if server == nil {
 		http.Error(w, "No healthy server available for this route", http.StatusServiceUnavailable)
 		return
 	}
+	if affinityCookie != nil {
+		http.SetCookie(w, affinityCookie)
+	}
 
 	// Optionally add custom headers
 	w.Header().Add("X-Forwarded-Path", path)
 	w.Header().Add("X-Forwarded-Host", r.Host)
 
-	// Route the request to the backend server using reverse proxy
-	server.ReverseProxy().ServeHTTP(w, r)
+	// Route the request to the backend server using reverse proxy, counting it as in flight for
+	// connection-based balancers and so draining servers can tell when they are idle
+	server.StartRequest()
+	defer server.EndRequest()
+	failed := proxy(w, r, server)
+
+	// Feed passive health checking of the route with the outcome
+	h.lb.RecordOutcome(r, server, failed)
+}
+
+// proxy forwards the request to the server and reports whether the server failed it: it could not be
+// reached, timed out or answered with a 5xx status.
+func proxy(w http.ResponseWriter, r *http.Request, server *domain.Server) bool {
+	failed := false
+	reverseProxy := server.ReverseProxy()
+	reverseProxy.ModifyResponse = func(resp *http.Response) error {
+		failed = resp.StatusCode >= http.StatusInternalServerError
+		return nil
+	}
+	reverseProxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		log.Printf("http: proxy error: %v", err)
+		// A client that went away says nothing about the server
+		failed = r.Context().Err() == nil
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	reverseProxy.ServeHTTP(w, r)
+	return failed
 }
@@ -5,10 +5,11 @@ package handlers
 
 import (
 	"crypto/tls"
-	"log"
 	"net/http"
 	"time"
 
+	"github.com/go-acme/lego/v4/challenge/tlsalpn01"
+
 	"github.com/thetonbr/breezegate/internal/services"
 )
 
@@ -18,28 +19,20 @@ const (
 	httpsReadHeaderTimeout = 10 * time.Second
 )
 
-// SetupACMEAutoTLS configures and starts an HTTPS server with automatic TLS certificates from Let's Encrypt.
-func SetupACMEAutoTLS(acmeService *services.ACMEClient, domain string, handler http.Handler) {
-	cert, err := acmeService.ObtainCertificate(domain)
-	if err != nil {
-		log.Fatalf("Failed to obtain certificate: %s\n", err.Error())
-	}
-
-	server := &http.Server{
-		Addr:              ":443",
+// NewTLSServer creates the HTTPS server shared by all TLS domains. Certificates are selected per
+// handshake by SNI from the certificate store, so domains can be added to the store while it runs.
+// The server also negotiates acme-tls/1 so it can answer TLS-ALPN-01 challenges.
+func NewTLSServer(addr string, store *services.CertificateStore, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
 		Handler:           handler,
 		ReadTimeout:       httpsReadTimeout,
 		WriteTimeout:      httpsWriteTimeout,
 		ReadHeaderTimeout: httpsReadHeaderTimeout,
 		TLSConfig: &tls.Config{
-			Certificates: []tls.Certificate{*cert},
-			MinVersion:   tls.VersionTLS12,
+			GetCertificate: store.GetCertificate,
+			MinVersion:     tls.VersionTLS12,
+			NextProtos:     []string{"h2", "http/1.1", tlsalpn01.ACMETLS1Protocol},
 		},
 	}
-
-	log.Println("Starting HTTPS server with Let's Encrypt for domain:", domain)
-	err = server.ListenAndServeTLS("", "")
-	if err != nil {
-		log.Fatalf("Error starting HTTPS server: %s\n", err.Error())
-	}
 }
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/go-acme/lego/v4/challenge/tlsalpn01"
+)
+
+// ChallengeType identifies how ACME validates control of a domain.
+type ChallengeType string
+
+const (
+	// ChallengeDNS01 publishes a TXT record through a DNS provider.
+	ChallengeDNS01 ChallengeType = "dns-01"
+	// ChallengeHTTP01 answers a request to /.well-known/acme-challenge/ on port 80.
+	ChallengeHTTP01 ChallengeType = "http-01"
+	// ChallengeTLSALPN01 presents a special certificate on the HTTPS listener.
+	ChallengeTLSALPN01 ChallengeType = "tls-alpn-01"
+)
+
+// ParseChallengeType converts a configuration value into a ChallengeType. An empty value means dns-01.
+func ParseChallengeType(value string) (ChallengeType, error) {
+	switch ChallengeType(value) {
+	case "", ChallengeDNS01:
+		return ChallengeDNS01, nil
+	case ChallengeHTTP01:
+		return ChallengeHTTP01, nil
+	case ChallengeTLSALPN01:
+		return ChallengeTLSALPN01, nil
+	default:
+		return "", fmt.Errorf("unknown ACME challenge type %q", value)
+	}
+}
+
+// HTTPChallengeProvider solves HTTP-01 challenges through BreezeGate's own HTTP listener instead of
+// binding a separate server. It implements the lego challenge.Provider interface.
+type HTTPChallengeProvider struct {
+	tokens map[string]string
+	mu     sync.RWMutex
+}
+
+// NewHTTPChallengeProvider creates an HTTPChallengeProvider with no pending challenges.
+func NewHTTPChallengeProvider() *HTTPChallengeProvider {
+	return &HTTPChallengeProvider{
+		tokens: make(map[string]string),
+	}
+}
+
+// Present makes the key authorization available for the challenge token.
+func (p *HTTPChallengeProvider) Present(_, token, keyAuth string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tokens[token] = keyAuth
+	return nil
+}
+
+// CleanUp removes the challenge token once validation has finished.
+func (p *HTTPChallengeProvider) CleanUp(_, token, _ string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.tokens, token)
+	return nil
+}
+
+// KeyAuthorization returns the key authorization for a pending challenge token.
+func (p *HTTPChallengeProvider) KeyAuthorization(token string) (string, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	keyAuth, exists := p.tokens[token]
+	return keyAuth, exists
+}
+
+// TLSALPNChallengeProvider solves TLS-ALPN-01 challenges by placing challenge certificates in the
+// certificate store used by the HTTPS listener. It implements the lego challenge.Provider interface.
+type TLSALPNChallengeProvider struct {
+	store *CertificateStore
+}
+
+// NewTLSALPNChallengeProvider creates a TLSALPNChallengeProvider that serves from the given store.
+func NewTLSALPNChallengeProvider(store *CertificateStore) *TLSALPNChallengeProvider {
+	return &TLSALPNChallengeProvider{store: store}
+}
+
+// Present generates the challenge certificate for the domain and publishes it.
+func (p *TLSALPNChallengeProvider) Present(domain, _, keyAuth string) error {
+	cert, err := tlsalpn01.ChallengeCert(domain, keyAuth)
+	if err != nil {
+		return err
+	}
+	p.store.PutChallenge(domain, cert)
+	return nil
+}
+
+// CleanUp removes the challenge certificate for the domain.
+func (p *TLSALPNChallengeProvider) CleanUp(domain, _, _ string) error {
+	p.store.RemoveChallenge(domain)
+	return nil
+}
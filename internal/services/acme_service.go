@@ -6,12 +6,19 @@ package services
 import (
 	"crypto"
 	"crypto/tls"
-	"os"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/go-acme/lego/v4/certcrypto"
 	"github.com/go-acme/lego/v4/certificate"
+	"github.com/go-acme/lego/v4/challenge"
 	"github.com/go-acme/lego/v4/lego"
-	"github.com/go-acme/lego/v4/providers/dns/cloudflare"
 	"github.com/go-acme/lego/v4/registration"
 )
 
@@ -21,8 +28,10 @@ const (
 
 // ACMEClient manages Let's Encrypt certificates using the ACME protocol.
 type ACMEClient struct {
-	config *lego.Config
-	client *lego.Client
+	config      *lego.Config
+	client      *lego.Client
+	storage     Storage
+	renewBefore time.Duration
 }
 
 // User implements the acme.User interface required by the lego library.
@@ -47,77 +56,255 @@ func (u *User) GetPrivateKey() crypto.PrivateKey {
 	return u.Key
 }
 
-// NewACMEClient creates a new ACMEClient for the specified email and domain.
-func NewACMEClient(email, _ string) (*ACMEClient, error) {
-	privateKey, err := certcrypto.GeneratePrivateKey(certcrypto.RSA2048)
+// ExternalAccountBinding holds the credentials some CAs, such as ZeroSSL or a private step-ca,
+// require to bind a new ACME account to an existing account.
+type ExternalAccountBinding struct {
+	KeyID   string
+	HMACKey string // base64url encoded
+}
+
+// ACMEOptions selects the CA an ACMEClient talks to and how it proves control of its domains.
+type ACMEOptions struct {
+	// DirectoryURL is the ACME directory of the CA; empty means Let's Encrypt production.
+	DirectoryURL string
+	// RootCAs are trusted in addition to the system roots when connecting to the CA, e.g. for a
+	// private CA or a local test server such as Pebble.
+	RootCAs *x509.CertPool
+	// KeyType is used for the account key and certificate keys; empty means RSA 2048.
+	KeyType certcrypto.KeyType
+	// EAB is required by CAs that use External Account Binding; nil means none.
+	EAB *ExternalAccountBinding
+	// Challenge is the challenge type to solve; empty means dns-01.
+	Challenge ChallengeType
+	// RenewBefore is how long before its expiry a stored certificate is reissued rather than reused;
+	// zero means 30 days.
+	RenewBefore time.Duration
+	// Provider answers the challenge. For dns-01 a nil Provider uses Cloudflare configured from the
+	// environment (see NewDNSProvider); http-01 and tls-alpn-01 require the providers served by
+	// BreezeGate's listeners.
+	Provider challenge.Provider
+}
+
+// ParseKeyType converts a configuration value into a key type. The names match lego's --key-type
+// flag: "ec256", "ec384", "rsa2048", "rsa3072", "rsa4096" and "rsa8192". An empty value means rsa2048.
+func ParseKeyType(value string) (certcrypto.KeyType, error) {
+	switch strings.ToLower(value) {
+	case "", "rsa2048":
+		return certcrypto.RSA2048, nil
+	case "rsa3072":
+		return certcrypto.RSA3072, nil
+	case "rsa4096":
+		return certcrypto.RSA4096, nil
+	case "rsa8192":
+		return certcrypto.RSA8192, nil
+	case "ec256":
+		return certcrypto.EC256, nil
+	case "ec384":
+		return certcrypto.EC384, nil
+	default:
+		return "", fmt.Errorf("unknown key type %q", value)
+	}
+}
+
+// NewACMEClient creates a new ACMEClient for the specified email. The ACME account is loaded from
+// storage when one was registered before, and registered and saved otherwise.
+func NewACMEClient(email string, storage Storage, opts ACMEOptions) (*ACMEClient, error) {
+	unlock, err := storage.Lock("account-" + email)
 	if err != nil {
 		return nil, err
 	}
+	defer unlock()
 
-	user := &User{
-		Email: email,
-		Key:   privateKey,
+	if opts.KeyType == "" {
+		opts.KeyType = certcrypto.RSA2048
+	}
+	if opts.RenewBefore <= 0 {
+		opts.RenewBefore = defaultRenewBefore
+	}
+
+	user, err := loadUser(storage, email, opts.KeyType)
+	if err != nil {
+		return nil, err
 	}
 
 	acmeCfg := lego.NewConfig(user)
-	acmeCfg.Certificate.KeyType = certcrypto.RSA2048
+	acmeCfg.Certificate.KeyType = opts.KeyType
+	if opts.DirectoryURL != "" {
+		acmeCfg.CADirURL = opts.DirectoryURL
+	}
+	if opts.RootCAs != nil {
+		transport, ok := acmeCfg.HTTPClient.Transport.(*http.Transport)
+		if !ok {
+			return nil, errors.New("unexpected ACME HTTP transport")
+		}
+		transport.TLSClientConfig.RootCAs = opts.RootCAs
+	}
 
 	client, err := lego.NewClient(acmeCfg)
 	if err != nil {
 		return nil, err
 	}
 
-	// Configure DNS provider (e.g., Cloudflare)
-	provider, err := cloudflare.NewDNSProvider()
+	err = setChallengeProvider(client, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	err = client.Challenge.SetDNS01Provider(provider)
+	if user.Registration == nil {
+		user.Registration, err = register(client, opts.EAB)
+		if err != nil {
+			return nil, err
+		}
+
+		err = storage.SaveAccount(&ACMEAccount{
+			Email:        email,
+			Registration: user.Registration,
+			KeyPEM:       certcrypto.PEMEncode(user.Key),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &ACMEClient{
+		config:      acmeCfg,
+		client:      client,
+		storage:     storage,
+		renewBefore: opts.RenewBefore,
+	}, nil
+}
+
+// register creates a new ACME account, using External Account Binding when credentials are given.
+func register(client *lego.Client, eab *ExternalAccountBinding) (*registration.Resource, error) {
+	if eab == nil {
+		return client.Registration.Register(registration.RegisterOptions{TermsOfServiceAgreed: true})
+	}
+	return client.Registration.RegisterWithExternalAccountBinding(registration.RegisterEABOptions{
+		TermsOfServiceAgreed: true,
+		Kid:                  eab.KeyID,
+		HmacEncoded:          eab.HMACKey,
+	})
+}
+
+// setChallengeProvider configures the lego client to solve the challenge type selected in opts.
+func setChallengeProvider(client *lego.Client, opts ACMEOptions) error {
+	challengeType, err := ParseChallengeType(string(opts.Challenge))
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	reg, err := client.Registration.Register(registration.RegisterOptions{TermsOfServiceAgreed: true})
+	switch challengeType {
+	case ChallengeHTTP01:
+		if opts.Provider == nil {
+			return errors.New("http-01 challenge requires a provider")
+		}
+		return client.Challenge.SetHTTP01Provider(opts.Provider)
+	case ChallengeTLSALPN01:
+		if opts.Provider == nil {
+			return errors.New("tls-alpn-01 challenge requires a provider")
+		}
+		return client.Challenge.SetTLSALPN01Provider(opts.Provider)
+	case ChallengeDNS01:
+		provider := opts.Provider
+		if provider == nil {
+			provider, err = NewDNSProvider(DNSProviderCloudflare, nil)
+			if err != nil {
+				return err
+			}
+		}
+		return client.Challenge.SetDNS01Provider(provider)
+	}
+	return nil
+}
+
+// loadUser restores the stored account for the email, or creates a new unregistered user with a fresh key.
+func loadUser(storage Storage, email string, keyType certcrypto.KeyType) (*User, error) {
+	account, err := storage.LoadAccount(email)
+	if errors.Is(err, fs.ErrNotExist) {
+		privateKey, genErr := certcrypto.GeneratePrivateKey(keyType)
+		if genErr != nil {
+			return nil, genErr
+		}
+		return &User{Email: email, Key: privateKey}, nil
+	}
 	if err != nil {
 		return nil, err
 	}
-	user.Registration = reg
 
-	return &ACMEClient{
-		config: acmeCfg,
-		client: client,
+	privateKey, err := certcrypto.ParsePEMPrivateKey(account.KeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	return &User{
+		Email:        email,
+		Registration: account.Registration,
+		Key:          privateKey,
 	}, nil
 }
 
-// ObtainCertificate generates a TLS certificate for the specified domain using Let's Encrypt.
-func (ac *ACMEClient) ObtainCertificate(domain string) (*tls.Certificate, error) {
-	request := certificate.ObtainRequest{
-		Domains: []string{domain},
-		Bundle:  true,
+// ObtainCertificate generates one TLS certificate covering all specified domains using Let's Encrypt
+// and saves it to storage under the first domain. Wildcard domains require the dns-01 challenge.
+func (ac *ACMEClient) ObtainCertificate(domains ...string) (*tls.Certificate, error) {
+	if len(domains) == 0 {
+		return nil, errors.New("no domains to obtain a certificate for")
 	}
+	domain := domains[0]
 
-	certificates, err := ac.client.Certificate.Obtain(request)
+	unlock, err := ac.storage.Lock("certificate-" + domain)
 	if err != nil {
 		return nil, err
 	}
+	defer unlock()
+
+	// Another instance sharing the storage may have renewed the certificate while this one waited
+	if stored, loadErr := ac.storage.LoadCertificate(domain); loadErr == nil && !ac.dueForRenewal(stored, domains) {
+		return stored, nil
+	}
 
-	// Save certificates to disk
-	err = os.WriteFile(domain+".crt", certificates.Certificate, certFilePermissions)
+	request := certificate.ObtainRequest{
+		Domains: domains,
+		Bundle:  true,
+	}
+
+	certificates, err := ac.client.Certificate.Obtain(request)
 	if err != nil {
 		return nil, err
 	}
 
-	err = os.WriteFile(domain+".key", certificates.PrivateKey, certFilePermissions)
+	// Save certificates to storage
+	err = ac.storage.SaveCertificate(domain, certificates.Certificate, certificates.PrivateKey)
 	if err != nil {
 		return nil, err
 	}
 
 	// Load the certificate
-	tlsCert, err := tls.LoadX509KeyPair(domain+".crt", domain+".key")
+	tlsCert, err := tls.X509KeyPair(certificates.Certificate, certificates.PrivateKey)
 	if err != nil {
 		return nil, err
 	}
 
 	return &tlsCert, nil
 }
+
+// dueForRenewal reports whether a certificate must be reissued because it does not cover all domains
+// or expires within the renewal window.
+func (ac *ACMEClient) dueForRenewal(cert *tls.Certificate, domains []string) bool {
+	leaf, err := certificateLeaf(cert)
+	if err != nil || !certificateCovers(leaf, domains) {
+		return true
+	}
+	return time.Until(leaf.NotAfter) <= ac.renewBefore
+}
+
+// StorageNamespace returns a directory name that identifies the CA behind an ACME directory URL, so
+// accounts and certificates from different CAs (for example staging and production) are kept apart.
+func StorageNamespace(directoryURL string) string {
+	if directoryURL == "" {
+		directoryURL = lego.LEDirectoryProduction
+	}
+	parsed, err := url.Parse(directoryURL)
+	if err != nil || parsed.Host == "" {
+		return "default"
+	}
+	return strings.ReplaceAll(parsed.Host, ":", "_")
+}
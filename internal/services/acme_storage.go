@@ -0,0 +1,195 @@
+package services
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-acme/lego/v4/registration"
+)
+
+const (
+	storageDirPermissions = 0o700
+	lockRetryInterval     = 100 * time.Millisecond
+	lockTimeout           = 5 * time.Minute
+)
+
+// ErrLockTimeout is returned when a storage lock cannot be acquired in time.
+var ErrLockTimeout = errors.New("timed out waiting for storage lock")
+
+// ACMEAccount is a registered ACME account as kept in Storage.
+type ACMEAccount struct {
+	Email        string                 `json:"email"`
+	Registration *registration.Resource `json:"registration"`
+	KeyPEM       []byte                 `json:"-"`
+}
+
+// Storage persists ACME accounts and certificates so they survive restarts.
+// Load methods return an error wrapping fs.ErrNotExist when nothing is stored.
+type Storage interface {
+	LoadAccount(email string) (*ACMEAccount, error)
+	SaveAccount(account *ACMEAccount) error
+	LoadCertificate(domain string) (*tls.Certificate, error)
+	SaveCertificate(domain string, certPEM, keyPEM []byte) error
+	// Lock acquires an exclusive lock on the named resource, which may be shared with other
+	// BreezeGate instances using the same storage. The returned function releases it.
+	Lock(name string) (func(), error)
+}
+
+// FileStorage stores accounts and certificates as PEM and JSON files below a directory:
+//
+//	accounts/<email>/account.json
+//	accounts/<email>/account.key
+//	certificates/<domain>.crt
+//	certificates/<domain>.key
+//	locks/<name>.lock
+type FileStorage struct {
+	dir string
+}
+
+// NewFileStorage creates a FileStorage rooted at dir, creating the directory if needed.
+func NewFileStorage(dir string) (*FileStorage, error) {
+	if err := os.MkdirAll(dir, storageDirPermissions); err != nil {
+		return nil, err
+	}
+	return &FileStorage{dir: dir}, nil
+}
+
+// LoadAccount reads the account registered for the given email.
+func (s *FileStorage) LoadAccount(email string) (*ACMEAccount, error) {
+	accountDir := s.path("accounts", email)
+	data, err := os.ReadFile(filepath.Join(accountDir, "account.json"))
+	if err != nil {
+		return nil, err
+	}
+	var account ACMEAccount
+	if err := json.Unmarshal(data, &account); err != nil {
+		return nil, fmt.Errorf("invalid account file for %s: %w", email, err)
+	}
+	account.KeyPEM, err = os.ReadFile(filepath.Join(accountDir, "account.key"))
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// SaveAccount writes the account and its private key.
+func (s *FileStorage) SaveAccount(account *ACMEAccount) error {
+	data, err := json.MarshalIndent(account, "", "  ")
+	if err != nil {
+		return err
+	}
+	accountDir := s.path("accounts", account.Email)
+	if err := writeFileAtomic(filepath.Join(accountDir, "account.key"), account.KeyPEM); err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(accountDir, "account.json"), data)
+}
+
+// LoadCertificate reads the certificate and private key stored for the given domain.
+func (s *FileStorage) LoadCertificate(domain string) (*tls.Certificate, error) {
+	certFile := s.path("certificates", domain+".crt")
+	keyFile := s.path("certificates", domain+".key")
+	if _, err := os.Stat(certFile); err != nil {
+		return nil, err
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// SaveCertificate writes the PEM encoded certificate chain and private key for the given domain.
+func (s *FileStorage) SaveCertificate(domain string, certPEM, keyPEM []byte) error {
+	if err := writeFileAtomic(s.path("certificates", domain+".key"), keyPEM); err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path("certificates", domain+".crt"), certPEM)
+}
+
+// Lock acquires a lock file for the named resource. The lock is held by the operating system, which
+// releases it when the process exits, so a crashed process never leaves the resource locked; the
+// lock file itself is kept for the next Lock.
+func (s *FileStorage) Lock(name string) (func(), error) {
+	lockFile := s.path("locks", name+".lock")
+	if err := os.MkdirAll(filepath.Dir(lockFile), storageDirPermissions); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(lockFile, os.O_CREATE|os.O_RDWR, certFilePermissions)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		locked, lockErr := tryLockFile(f)
+		if locked {
+			return func() { releaseLockFile(f) }, nil
+		}
+		if lockErr == nil && time.Now().After(deadline) {
+			lockErr = fmt.Errorf("%w: %s", ErrLockTimeout, name)
+		}
+		if lockErr != nil {
+			if closeErr := f.Close(); closeErr != nil {
+				log.Printf("Error closing lock file: %v", closeErr)
+			}
+			return nil, lockErr
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// releaseLockFile unlocks and closes a lock file acquired by Lock.
+func releaseLockFile(f *os.File) {
+	if err := unlockFile(f); err != nil {
+		log.Printf("Error releasing lock file: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		log.Printf("Error closing lock file: %v", err)
+	}
+}
+
+// path builds a file path below the storage directory. Wildcard names are stored with a "_"
+// in place of the "*" so they are valid file names everywhere.
+func (s *FileStorage) path(kind, name string) string {
+	name = strings.ReplaceAll(name, "*", "_")
+	return filepath.Join(s.dir, kind, filepath.Base(filepath.Clean("/"+name)))
+}
+
+// writeFileAtomic writes data to a temporary file and renames it into place, so readers never see
+// a partially written file.
+func writeFileAtomic(name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), storageDirPermissions); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// After a successful rename the temporary file no longer exists
+		if removeErr := os.Remove(tmp.Name()); removeErr != nil && !errors.Is(removeErr, fs.ErrNotExist) {
+			log.Printf("Error removing temporary file: %v", removeErr)
+		}
+	}()
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(certFilePermissions)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
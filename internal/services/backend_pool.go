@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/thetonbr/breezegate/internal/domain"
+)
+
+// BackendPool owns the backend servers of the load balancer and runs one health check per server.
+// Servers are shared by every route that lists the same URL and survive configuration reloads, so
+// their health status is kept when the routes around them change.
+type BackendPool struct {
+	ctx      context.Context
+	interval time.Duration
+	servers  map[string]*pooledServer
+	mu       sync.Mutex
+}
+
+type pooledServer struct {
+	server      *domain.Server
+	healthCheck HealthCheckOptions
+	// stop stops the health check; it is nil for a prepared server whose check has not started yet.
+	stop context.CancelFunc
+}
+
+// NewBackendPool creates an empty pool whose health checks run until the context is canceled.
+func NewBackendPool(ctx context.Context, interval time.Duration) *BackendPool {
+	return &BackendPool{ctx: ctx, interval: interval, servers: make(map[string]*pooledServer)}
+}
+
+// Prepare returns the server for the backend URL without touching any health check, so a new
+// configuration can be built without affecting the running one. A new server starts healthy unless
+// startUnhealthy is set, and its health check only starts with SetHealthChecks; the first result of
+// that check decides its health status regardless of the thresholds.
+func (p *BackendPool) Prepare(rawURL string, startUnhealthy bool) (*domain.Server, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if pooled, exists := p.servers[rawURL]; exists {
+		return pooled.server, nil
+	}
+	pooled, err := newPooledServer(rawURL, startUnhealthy)
+	if err != nil {
+		return nil, err
+	}
+	p.servers[rawURL] = pooled
+	return pooled.server, nil
+}
+
+// SetHealthChecks checks the health of every listed server as described by its options, starting the
+// health checks of prepared servers and restarting those whose options differ from the ones they run
+// with. Servers keep their health status.
+func (p *BackendPool) SetHealthChecks(healthChecks map[string]HealthCheckOptions) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for rawURL, opts := range healthChecks {
+		pooled, exists := p.servers[rawURL]
+		if !exists || (pooled.stop != nil && reflect.DeepEqual(pooled.healthCheck, opts)) {
+			continue
+		}
+		initial := pooled.stop == nil
+		if !initial {
+			pooled.stop()
+		}
+		pooled.healthCheck = opts
+		pooled.stop = p.startHealthCheck(pooled, initial)
+	}
+}
+
+func newPooledServer(rawURL string, startUnhealthy bool) (*pooledServer, error) {
+	server, err := domain.NewServer(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if startUnhealthy {
+		server.SetHealthStatus(false)
+	}
+	return &pooledServer{server: server}, nil
+}
+
+// Lookup returns the server for the backend URL, or nil if the pool does not have it.
+func (p *BackendPool) Lookup(rawURL string) *domain.Server {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if pooled, exists := p.servers[rawURL]; exists {
+		return pooled.server
+	}
+	return nil
+}
+
+// Servers returns all servers of the pool ordered by URL.
+func (p *BackendPool) Servers() []*domain.Server {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	servers := make([]*domain.Server, 0, len(p.servers))
+	for _, pooled := range p.servers {
+		servers = append(servers, pooled.server)
+	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].URL.String() < servers[j].URL.String() })
+	return servers
+}
+
+// SetInterval changes the default health check interval, restarting the health checks of the servers
+// that use it if it differs.
+func (p *BackendPool) SetInterval(interval time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if interval == p.interval {
+		return
+	}
+	p.interval = interval
+	for _, pooled := range p.servers {
+		if pooled.stop != nil && pooled.healthCheck.Interval == 0 {
+			pooled.stop()
+			pooled.stop = p.startHealthCheck(pooled, false)
+		}
+	}
+}
+
+// Retain removes every server whose URL is not listed and stops its health check.
+func (p *BackendPool) Retain(urls []string) {
+	keep := make(map[string]bool, len(urls))
+	for _, rawURL := range urls {
+		keep[rawURL] = true
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for rawURL, pooled := range p.servers {
+		if !keep[rawURL] {
+			if pooled.stop != nil {
+				pooled.stop()
+			}
+			delete(p.servers, rawURL)
+		}
+	}
+}
+
+// startHealthCheck starts the health check of a server and returns the function that stops it. The
+// first check of a server is initial: its first result decides the health status. The caller must
+// hold the lock.
+func (p *BackendPool) startHealthCheck(pooled *pooledServer, initial bool) context.CancelFunc {
+	ctx, cancel := context.WithCancel(p.ctx)
+	opts := pooled.healthCheck
+	if opts.Interval == 0 {
+		opts.Interval = p.interval
+	}
+	go checkHealth(ctx, pooled.server, opts, initial)
+	return cancel
+}
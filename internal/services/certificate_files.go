@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// defaultCertificateFilePollInterval is how often certificate files are checked for changes.
+const defaultCertificateFilePollInterval = 30 * time.Second
+
+// CertificateFiles names the PEM files of a certificate issued outside of ACME, e.g. by a corporate PKI.
+type CertificateFiles struct {
+	CertFile string
+	KeyFile  string
+	// CAFile optionally holds intermediate certificates that are served after the certificate.
+	CAFile string
+}
+
+// Load reads the key pair and appends the CA chain, if any.
+func (f CertificateFiles) Load() (*tls.Certificate, error) {
+	if f.CertFile == "" || f.KeyFile == "" {
+		return nil, errors.New("both certFile and keyFile are required")
+	}
+	cert, err := tls.LoadX509KeyPair(f.CertFile, f.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load key pair %s: %w", f.CertFile, err)
+	}
+	if f.CAFile == "" {
+		return &cert, nil
+	}
+
+	chain, err := os.ReadFile(f.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA chain: %w", err)
+	}
+	intermediates, err := decodeCertificates(chain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA chain %s: %w", f.CAFile, err)
+	}
+	cert.Certificate = append(cert.Certificate, intermediates...)
+	return &cert, nil
+}
+
+// decodeCertificates returns the DER bytes of every CERTIFICATE block in PEM data.
+func decodeCertificates(data []byte) ([][]byte, error) {
+	var certs [][]byte
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			certs = append(certs, block.Bytes)
+		}
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificates found")
+	}
+	return certs, nil
+}
+
+// paths returns the files that make up the certificate.
+func (f CertificateFiles) paths() []string {
+	paths := []string{f.CertFile, f.KeyFile}
+	if f.CAFile != "" {
+		paths = append(paths, f.CAFile)
+	}
+	return paths
+}
+
+// CertificateFileWatcher keeps a certificate loaded from files in a CertificateStore and reloads it
+// whenever the files change on disk.
+type CertificateFileWatcher struct {
+	store    *CertificateStore
+	names    []string
+	files    CertificateFiles
+	interval time.Duration
+	versions []fileVersion
+}
+
+// fileVersion identifies the content of a file on disk by its modification time and size.
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewCertificateFileWatcher creates a watcher that stores the certificate from files under every
+// given host name. A zero interval polls every 30 seconds.
+func NewCertificateFileWatcher(
+	store *CertificateStore, names []string, files CertificateFiles, interval time.Duration,
+) *CertificateFileWatcher {
+	if interval <= 0 {
+		interval = defaultCertificateFilePollInterval
+	}
+	return &CertificateFileWatcher{store: store, names: names, files: files, interval: interval}
+}
+
+// Load reads the certificate files and installs the certificate in the store.
+func (w *CertificateFileWatcher) Load() error {
+	versions, err := w.statFiles()
+	if err != nil {
+		return err
+	}
+	cert, err := w.files.Load()
+	if err != nil {
+		return err
+	}
+	leaf, err := certificateLeaf(cert)
+	if err != nil {
+		return err
+	}
+	if !certificateCovers(leaf, w.names) {
+		log.Printf("Certificate %s does not list all of %s", w.files.CertFile, strings.Join(w.names, ", "))
+	}
+	w.store.PutAll(w.names, cert)
+	w.versions = versions
+	return nil
+}
+
+// Watch polls the certificate files and reloads the certificate when any of them changes. A reload
+// that fails, e.g. because the key was not yet replaced along with the certificate, keeps serving the
+// previous certificate and is retried on the next poll. Watch blocks until the context is canceled.
+func (w *CertificateFileWatcher) Watch(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !w.changed() {
+			continue
+		}
+		if err := w.Load(); err != nil {
+			log.Printf("Failed to reload certificate for %s: %s", w.names[0], err.Error())
+			continue
+		}
+		log.Printf("Reloaded certificate for %s from %s", w.names[0], w.files.CertFile)
+	}
+}
+
+// changed reports whether any certificate file differs from the last successful load.
+func (w *CertificateFileWatcher) changed() bool {
+	versions, err := w.statFiles()
+	if err != nil {
+		log.Printf("Failed to check certificate files for %s: %s", w.names[0], err.Error())
+		return false
+	}
+	for i := range versions {
+		if i >= len(w.versions) || !versions[i].modTime.Equal(w.versions[i].modTime) ||
+			versions[i].size != w.versions[i].size {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *CertificateFileWatcher) statFiles() ([]fileVersion, error) {
+	paths := w.files.paths()
+	versions := make([]fileVersion, 0, len(paths))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, fileVersion{modTime: info.ModTime(), size: info.Size()})
+	}
+	return versions, nil
+}
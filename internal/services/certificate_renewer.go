@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"log"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRenewBefore        = 30 * 24 * time.Hour
+	defaultRenewCheckInterval = 12 * time.Hour
+	defaultRenewRetryBase     = time.Minute
+	defaultRenewRetryMax      = 6 * time.Hour
+)
+
+// CertificateIssuer obtains one certificate covering all given domains, the first of which is its
+// primary name. ACMEClient is the production implementation.
+type CertificateIssuer interface {
+	ObtainCertificate(domains ...string) (*tls.Certificate, error)
+}
+
+// RenewalOptions controls when certificates are renewed and how failed attempts are retried.
+// Zero values select the defaults: renew 30 days before expiry, check every 12 hours, and retry
+// failures with jittered exponential backoff from 1 minute up to 6 hours.
+type RenewalOptions struct {
+	RenewBefore   time.Duration
+	CheckInterval time.Duration
+	RetryBase     time.Duration
+	RetryMax      time.Duration
+}
+
+// CertificateRenewer keeps the certificates in a CertificateStore issued and renewed.
+type CertificateRenewer struct {
+	store *CertificateStore
+	opts  RenewalOptions
+}
+
+// NewCertificateRenewer creates a CertificateRenewer that publishes certificates into the given store.
+func NewCertificateRenewer(store *CertificateStore, opts RenewalOptions) *CertificateRenewer {
+	if opts.RenewBefore <= 0 {
+		opts.RenewBefore = defaultRenewBefore
+	}
+	if opts.CheckInterval <= 0 {
+		opts.CheckInterval = defaultRenewCheckInterval
+	}
+	if opts.RetryBase <= 0 {
+		opts.RetryBase = defaultRenewRetryBase
+	}
+	if opts.RetryMax < opts.RetryBase {
+		opts.RetryMax = max(defaultRenewRetryMax, opts.RetryBase)
+	}
+	return &CertificateRenewer{store: store, opts: opts}
+}
+
+// Watch issues a certificate for the names if the store has none, then renews it whenever it gets
+// within RenewBefore of its expiry or no longer covers all names. The certificate is stored under
+// every name and looked up by the first one. Renewed certificates replace the old ones in the store,
+// so the HTTPS listener serves them on the next handshake without dropping existing connections.
+// Watch blocks until the context is canceled.
+func (r *CertificateRenewer) Watch(ctx context.Context, names []string, issuer CertificateIssuer) {
+	domain := names[0]
+	failures := 0
+	for {
+		wait := r.untilRenewal(names)
+		if wait <= 0 {
+			if err := r.renew(names, issuer); err != nil {
+				failures++
+				wait = r.retryDelay(failures)
+				log.Printf("Failed to renew certificate for %s (attempt %d), retrying in %s: %s",
+					domain, failures, wait.Round(time.Second), err.Error())
+			} else {
+				failures = 0
+				if wait = r.untilRenewal(names); wait <= 0 {
+					// The new certificate is already inside the renewal window; avoid reissuing in a loop.
+					wait = r.opts.CheckInterval
+					log.Printf("Certificate for %s expires within the renewal window right after issuance", domain)
+				}
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// untilRenewal returns how long to wait before the certificate for the names should be renewed,
+// capped at the check interval. A zero or negative result means it is due now.
+func (r *CertificateRenewer) untilRenewal(names []string) time.Duration {
+	cert := r.store.Get(names[0])
+	if cert == nil {
+		return 0
+	}
+	leaf, err := certificateLeaf(cert)
+	if err != nil || !certificateCovers(leaf, names) {
+		return 0
+	}
+	return min(time.Until(leaf.NotAfter.Add(-r.opts.RenewBefore)), r.opts.CheckInterval)
+}
+
+func (r *CertificateRenewer) renew(names []string, issuer CertificateIssuer) error {
+	cert, err := issuer.ObtainCertificate(names...)
+	if err != nil {
+		return err
+	}
+	r.store.PutAll(names, cert)
+	log.Printf("Installed new certificate for %s", strings.Join(names, ", "))
+	return nil
+}
+
+// certificateCovers reports whether the certificate lists every name as a subject alternative name.
+// Wildcard names must be listed literally; a wildcard SAN does not cover the apex domain.
+func certificateCovers(leaf *x509.Certificate, names []string) bool {
+	for _, name := range names {
+		name = normalizeServerName(name)
+		if !slices.ContainsFunc(leaf.DNSNames, func(san string) bool { return normalizeServerName(san) == name }) {
+			return false
+		}
+	}
+	return true
+}
+
+// retryDelay returns the exponential backoff for the given number of consecutive failures,
+// with jitter so that many domains failing together do not retry in lockstep.
+func (r *CertificateRenewer) retryDelay(failures int) time.Duration {
+	delay := r.opts.RetryBase
+	for i := 1; i < failures && delay < r.opts.RetryMax; i++ {
+		delay *= 2
+	}
+	delay = min(delay, r.opts.RetryMax)
+	half := delay / 2
+	return half + rand.N(half+1) //nolint:gosec // jitter does not need a secure source
+}
+
+// certificateLeaf returns the parsed leaf of a certificate chain.
+func certificateLeaf(cert *tls.Certificate) (*x509.Certificate, error) {
+	if cert.Leaf != nil {
+		return cert.Leaf, nil
+	}
+	if len(cert.Certificate) == 0 {
+		return nil, ErrNoCertificate
+	}
+	return x509.ParseCertificate(cert.Certificate[0])
+}
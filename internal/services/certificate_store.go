@@ -0,0 +1,128 @@
+package services
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/go-acme/lego/v4/challenge/tlsalpn01"
+)
+
+// ErrNoCertificate is returned when no certificate matches a TLS handshake.
+var ErrNoCertificate = errors.New("no certificate available")
+
+// CertificateStore holds the certificates served by the HTTPS listener, indexed by host name.
+// It is safe for concurrent use, so certificates can be added or replaced while the listener runs.
+type CertificateStore struct {
+	certs       map[string]*tls.Certificate
+	challenges  map[string]*tls.Certificate
+	defaultName string
+	mu          sync.RWMutex
+}
+
+// NewCertificateStore creates an empty CertificateStore.
+func NewCertificateStore() *CertificateStore {
+	return &CertificateStore{
+		certs:      make(map[string]*tls.Certificate),
+		challenges: make(map[string]*tls.Certificate),
+	}
+}
+
+// Put stores the certificate for the given host name, replacing any previous one.
+// Wildcard names such as "*.example.com" are served to every direct subdomain.
+func (s *CertificateStore) Put(name string, cert *tls.Certificate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.certs[normalizeServerName(name)] = cert
+}
+
+// PutAll stores one certificate under every given host name, e.g. all names it was issued for.
+func (s *CertificateStore) PutAll(names []string, cert *tls.Certificate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, name := range names {
+		s.certs[normalizeServerName(name)] = cert
+	}
+}
+
+// Remove deletes the certificate stored for the given host name.
+func (s *CertificateStore) Remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.certs, normalizeServerName(name))
+}
+
+// Get returns the certificate for the given host name, or nil if there is none.
+func (s *CertificateStore) Get(name string) *tls.Certificate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lookup(normalizeServerName(name))
+}
+
+// SetDefault names the certificate served to clients that send no SNI or an unknown server name.
+func (s *CertificateStore) SetDefault(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.defaultName = normalizeServerName(name)
+}
+
+// PutChallenge publishes a TLS-ALPN-01 challenge certificate for the given host name.
+func (s *CertificateStore) PutChallenge(name string, cert *tls.Certificate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.challenges[normalizeServerName(name)] = cert
+}
+
+// RemoveChallenge removes the TLS-ALPN-01 challenge certificate for the given host name.
+func (s *CertificateStore) RemoveChallenge(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.challenges, normalizeServerName(name))
+}
+
+// GetCertificate selects a certificate by SNI. It is meant to be used as tls.Config.GetCertificate.
+// Handshakes that negotiate the acme-tls/1 protocol are answered with the pending challenge certificate.
+func (s *CertificateStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if slices.Contains(hello.SupportedProtos, tlsalpn01.ACMETLS1Protocol) {
+		if cert, exists := s.challenges[normalizeServerName(hello.ServerName)]; exists {
+			return cert, nil
+		}
+		return nil, fmt.Errorf("%w: no pending TLS-ALPN-01 challenge for %q", ErrNoCertificate, hello.ServerName)
+	}
+
+	if hello.ServerName != "" {
+		if cert := s.lookup(normalizeServerName(hello.ServerName)); cert != nil {
+			return cert, nil
+		}
+	}
+	if cert := s.lookup(s.defaultName); cert != nil {
+		return cert, nil
+	}
+	return nil, fmt.Errorf("%w for server name %q", ErrNoCertificate, hello.ServerName)
+}
+
+// lookup finds the certificate for a normalized name, trying the matching wildcard name second.
+// The caller must hold the read lock.
+func (s *CertificateStore) lookup(name string) *tls.Certificate {
+	if name == "" {
+		return nil
+	}
+	if cert, exists := s.certs[name]; exists {
+		return cert
+	}
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		return s.certs["*"+name[i:]]
+	}
+	return nil
+}
+
+// normalizeServerName lowercases a server name and strips its trailing dot.
+func normalizeServerName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-acme/lego/v4/challenge"
+	"github.com/go-acme/lego/v4/providers/dns/cloudflare"
+	"github.com/go-acme/lego/v4/providers/dns/exec"
+	"github.com/go-acme/lego/v4/providers/dns/rfc2136"
+)
+
+const (
+	// DNSProviderCloudflare manages records through the Cloudflare API.
+	DNSProviderCloudflare = "cloudflare"
+	// DNSProviderRFC2136 sends RFC 2136 dynamic updates to a nameserver such as BIND or Knot.
+	DNSProviderRFC2136 = "rfc2136"
+	// DNSProviderExec runs an external program to present and clean up records.
+	DNSProviderExec = "exec"
+)
+
+// NewDNSProvider creates the DNS-01 challenge provider with the given name, configured from options.
+// An empty name selects Cloudflare. Options use the keys below; unknown keys are rejected so typos
+// do not go unnoticed. Durations use time.ParseDuration syntax.
+//
+//	all providers: ttl, propagationTimeout, pollingInterval
+//	cloudflare:    email, apiKey, dnsApiToken, zoneApiToken, baseUrl
+//	               (credentials are read from the CLOUDFLARE_* environment when none are given)
+//	rfc2136:       nameserver (required), tsigKey, tsigSecret, tsigAlgorithm, tsigFile,
+//	               dnsTimeout, sequenceInterval
+//	exec:          program (required), mode, sequenceInterval
+func NewDNSProvider(name string, options map[string]string) (challenge.Provider, error) {
+	if name == "" {
+		name = DNSProviderCloudflare
+	}
+	opts := &dnsProviderOptions{name: name, values: options}
+
+	var (
+		provider challenge.Provider
+		err      error
+	)
+	switch name {
+	case DNSProviderCloudflare:
+		provider, err = newCloudflareProvider(opts)
+	case DNSProviderRFC2136:
+		provider, err = newRFC2136Provider(opts)
+	case DNSProviderExec:
+		provider, err = newExecProvider(opts)
+	default:
+		return nil, fmt.Errorf("unknown DNS provider %q", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.checkUnused(); err != nil {
+		return nil, err
+	}
+	return provider, nil
+}
+
+func newCloudflareProvider(opts *dnsProviderOptions) (challenge.Provider, error) {
+	if !opts.hasAny("email", "apiKey", "dnsApiToken", "zoneApiToken") {
+		if len(opts.values) == 0 {
+			return cloudflare.NewDNSProvider()
+		}
+		return nil, fmt.Errorf("%s: credentials are required when options are given", DNSProviderCloudflare)
+	}
+
+	cfg := cloudflare.NewDefaultConfig()
+	cfg.AuthEmail = opts.string("email")
+	cfg.AuthKey = opts.string("apiKey")
+	cfg.AuthToken = opts.string("dnsApiToken")
+	cfg.ZoneToken = opts.string("zoneApiToken")
+	if baseURL := opts.string("baseUrl"); baseURL != "" {
+		cfg.BaseURL = baseURL
+	}
+	opts.int("ttl", &cfg.TTL)
+	opts.duration("propagationTimeout", &cfg.PropagationTimeout)
+	opts.duration("pollingInterval", &cfg.PollingInterval)
+	if err := opts.err; err != nil {
+		return nil, err
+	}
+	return cloudflare.NewDNSProviderConfig(cfg)
+}
+
+func newRFC2136Provider(opts *dnsProviderOptions) (challenge.Provider, error) {
+	cfg := rfc2136.NewDefaultConfig()
+	cfg.Nameserver = opts.string("nameserver")
+	cfg.TSIGKey = opts.string("tsigKey")
+	cfg.TSIGSecret = opts.string("tsigSecret")
+	cfg.TSIGFile = opts.string("tsigFile")
+	if algorithm := opts.string("tsigAlgorithm"); algorithm != "" {
+		cfg.TSIGAlgorithm = algorithm
+	}
+	opts.int("ttl", &cfg.TTL)
+	opts.duration("propagationTimeout", &cfg.PropagationTimeout)
+	opts.duration("pollingInterval", &cfg.PollingInterval)
+	opts.duration("sequenceInterval", &cfg.SequenceInterval)
+	opts.duration("dnsTimeout", &cfg.DNSTimeout)
+	if err := opts.err; err != nil {
+		return nil, err
+	}
+	return rfc2136.NewDNSProviderConfig(cfg)
+}
+
+func newExecProvider(opts *dnsProviderOptions) (challenge.Provider, error) {
+	cfg := exec.NewDefaultConfig()
+	cfg.Program = opts.string("program")
+	cfg.Mode = opts.string("mode")
+	opts.duration("propagationTimeout", &cfg.PropagationTimeout)
+	opts.duration("pollingInterval", &cfg.PollingInterval)
+	opts.duration("sequenceInterval", &cfg.SequenceInterval)
+	if err := opts.err; err != nil {
+		return nil, err
+	}
+	if cfg.Program == "" {
+		return nil, fmt.Errorf("%s: program is required", DNSProviderExec)
+	}
+	return exec.NewDNSProviderConfig(cfg)
+}
+
+// dnsProviderOptions reads typed values from a provider's option map, remembering which keys were
+// used and the first parse error.
+type dnsProviderOptions struct {
+	name   string
+	values map[string]string
+	used   []string
+	err    error
+}
+
+func (o *dnsProviderOptions) string(key string) string {
+	o.used = append(o.used, key)
+	return o.values[key]
+}
+
+func (o *dnsProviderOptions) hasAny(keys ...string) bool {
+	for _, key := range keys {
+		if o.values[key] != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *dnsProviderOptions) int(key string, target *int) {
+	value := o.string(key)
+	if value == "" || o.err != nil {
+		return
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		o.err = fmt.Errorf("%s: invalid %s %q: %w", o.name, key, value, err)
+		return
+	}
+	*target = parsed
+}
+
+func (o *dnsProviderOptions) duration(key string, target *time.Duration) {
+	value := o.string(key)
+	if value == "" || o.err != nil {
+		return
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		o.err = fmt.Errorf("%s: invalid %s %q: %w", o.name, key, value, err)
+		return
+	}
+	*target = parsed
+}
+
+func (o *dnsProviderOptions) checkUnused() error {
+	var unknown []string
+	for key := range o.values {
+		if !slices.Contains(o.used, key) {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("%s: unknown options %v", o.name, unknown)
+	}
+	return nil
+}
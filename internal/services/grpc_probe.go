@@ -0,0 +1,207 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	"github.com/thetonbr/breezegate/internal/domain"
+)
+
+// The grpc.health.v1 protocol.
+const (
+	grpcHealthCheckPath = "/grpc.health.v1.Health/Check"
+	// grpcMessagePrefix is the size of the compression flag and length that precede every message.
+	grpcMessagePrefix = 5
+	// grpcStatusOK is the grpc-status of a call that succeeded.
+	grpcStatusOK = "0"
+	// healthServing is the SERVING value of HealthCheckResponse.ServingStatus.
+	healthServing = 1
+	// grpcIdleConnTimeout closes connections to backends that are no longer probed.
+	grpcIdleConnTimeout = time.Minute
+)
+
+// healthStatusNames names the values of HealthCheckResponse.ServingStatus.
+var healthStatusNames = map[uint64]string{0: "UNKNOWN", 1: "SERVING", 2: "NOT_SERVING", 3: "SERVICE_UNKNOWN"}
+
+// The transports of gRPC probes keep their connections to backends between probes.
+var (
+	// h2cTransport speaks cleartext HTTP/2 with prior knowledge to http backends.
+	h2cTransport = &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, addr)
+		},
+		IdleConnTimeout: grpcIdleConnTimeout,
+	}
+	// h2Transport negotiates HTTP/2 over TLS with https backends.
+	h2Transport = &http2.Transport{IdleConnTimeout: grpcIdleConnTimeout}
+)
+
+// grpcProber checks backends with the standard gRPC health checking protocol, grpc.health.v1, in
+// cleartext for http backends and over TLS for https backends.
+type grpcProber struct {
+	service   string
+	authority string
+}
+
+// Probe implements Prober.
+func (p grpcProber) Probe(ctx context.Context, server *domain.Server) error {
+	target := url.URL{Scheme: server.URL.Scheme, Host: backendAddress(server.URL), Path: grpcHealthCheckPath}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.String(),
+		bytes.NewReader(healthCheckRequest(p.service)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+	if p.authority != "" {
+		req.Host = p.authority
+	}
+
+	transport := h2cTransport
+	if server.URL.Scheme == "https" {
+		transport = h2Transport
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			log.Printf("Error closing response body: %v", closeErr)
+		}
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	message, err := io.ReadAll(io.LimitReader(resp.Body, maxHealthCheckBody))
+	if err != nil {
+		return fmt.Errorf("error reading health response: %w", err)
+	}
+	if err = grpcStatus(resp); err != nil {
+		return err
+	}
+	status, err := parseHealthCheckResponse(message)
+	if err != nil {
+		return err
+	}
+	if status != healthServing {
+		name, known := healthStatusNames[status]
+		if !known {
+			name = fmt.Sprintf("status %d", status)
+		}
+		return fmt.Errorf("service is %s", name)
+	}
+	return nil
+}
+
+// healthCheckRequest returns the HealthCheckRequest message for service, framed for a gRPC call.
+func healthCheckRequest(service string) []byte {
+	// HealthCheckRequest has the service name as field 1
+	var request []byte
+	if service != "" {
+		request = append(request, 0x0a)
+		request = binary.AppendUvarint(request, uint64(len(service)))
+		request = append(request, service...)
+	}
+	message := make([]byte, grpcMessagePrefix, grpcMessagePrefix+len(request))
+	binary.BigEndian.PutUint32(message[1:], uint32(len(request))) //nolint:gosec // bounded by the service name
+	return append(message, request...)
+}
+
+// grpcStatus returns the error reported by the grpc-status of a finished call. It is sent in the
+// trailers, or in the headers of a response without messages.
+func grpcStatus(resp *http.Response) error {
+	header := resp.Trailer
+	if header.Get("Grpc-Status") == "" {
+		header = resp.Header
+	}
+	switch code := header.Get("Grpc-Status"); code {
+	case grpcStatusOK:
+		return nil
+	case "":
+		return errors.New("call ended without a grpc-status")
+	default:
+		// UNIMPLEMENTED (12) usually means the health service is not registered
+		return fmt.Errorf("call failed with grpc-status %s: %s", code, header.Get("Grpc-Message"))
+	}
+}
+
+// parseHealthCheckResponse decodes the serving status of a HealthCheckResponse message.
+func parseHealthCheckResponse(message []byte) (uint64, error) {
+	if len(message) < grpcMessagePrefix {
+		return 0, errors.New("call ended without a health response")
+	}
+	if message[0] != 0 {
+		return 0, errors.New("compressed health response")
+	}
+	length := int(binary.BigEndian.Uint32(message[1:grpcMessagePrefix]))
+	if len(message) != grpcMessagePrefix+length {
+		return 0, errors.New("malformed health response")
+	}
+
+	var status uint64
+	fields := message[grpcMessagePrefix:]
+	for len(fields) > 0 {
+		tag, n := binary.Uvarint(fields)
+		if n <= 0 {
+			return 0, errors.New("malformed health response")
+		}
+		var (
+			value uint64
+			err   error
+		)
+		value, fields, err = skipField(tag&0x7, fields[n:])
+		if err != nil {
+			return 0, err
+		}
+		if tag == 0x08 { // field 1, status, as a varint
+			status = value
+		}
+	}
+	return status, nil
+}
+
+// skipField consumes the protobuf field value of the given wire type, returning it if it is a varint.
+func skipField(wireType uint64, fields []byte) (uint64, []byte, error) {
+	size := 0
+	switch wireType {
+	case 0:
+		value, n := binary.Uvarint(fields)
+		if n <= 0 {
+			return 0, nil, errors.New("malformed health response")
+		}
+		return value, fields[n:], nil
+	case 1:
+		size = 8
+	case 2:
+		length, n := binary.Uvarint(fields)
+		if n <= 0 || length > uint64(len(fields)-n) {
+			return 0, nil, errors.New("malformed health response")
+		}
+		fields = fields[n:]
+		size = int(length) //nolint:gosec // bounded by the message length
+	case 5:
+		size = 4
+	default:
+		return 0, nil, fmt.Errorf("unsupported wire type %d in health response", wireType)
+	}
+	if size > len(fields) {
+		return 0, nil, errors.New("malformed health response")
+	}
+	return 0, fields[size:], nil
+}
@@ -0,0 +1,274 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/thetonbr/breezegate/internal/domain"
+)
+
+const (
+	// maxHealthCheckBody bounds how much of a response body is searched for the expected content.
+	maxHealthCheckBody = 64 << 10
+	// maxExecOutput bounds how much output of a failed exec probe is reported.
+	maxExecOutput = 512
+)
+
+// ProbeType selects how a backend server is probed.
+type ProbeType string
+
+// Supported probe types.
+const (
+	// ProbeHTTP sends an HTTP request and checks the response.
+	ProbeHTTP ProbeType = "http"
+	// ProbeTCP opens a TCP connection to the backend address.
+	ProbeTCP ProbeType = "tcp"
+	// ProbeGRPC calls the standard grpc.health.v1.Health/Check method.
+	ProbeGRPC ProbeType = "grpc"
+	// ProbeExec runs a local command; exit status 0 means healthy.
+	ProbeExec ProbeType = "exec"
+)
+
+// HealthCheckOptions configures how a backend server is probed. The zero value sends a HEAD request
+// to the backend URL and expects status 200 within 5 seconds.
+type HealthCheckOptions struct {
+	// Type selects the probe; empty means ProbeHTTP. The request options below apply to HTTP probes
+	// only, except Host, which gRPC probes send as the authority.
+	Type ProbeType
+	// Path is requested instead of the backend URL's own path; it may include a query.
+	Path string
+	// Method defaults to HEAD, or to GET if the body is checked.
+	Method string
+	// Host overrides the Host header, for backends that route by virtual host.
+	Host string
+	// Headers are added to every probe request.
+	Headers map[string]string
+	// ExpectedStatus lists the status codes that count as healthy; empty means 200 only.
+	ExpectedStatus []StatusRange
+	// BodyContains is a substring the response body must contain.
+	BodyContains string
+	// BodyRegex is a regular expression the response body must match.
+	BodyRegex string
+	// Timeout bounds a single probe; zero means 5 seconds.
+	Timeout time.Duration
+	// Service is the service whose health a gRPC probe asks for; empty means the whole server.
+	Service string
+	// Command is the program and arguments run by an exec probe.
+	Command []string
+	// Interval is the time between probes; zero means the interval of the backend pool.
+	Interval time.Duration
+	// HealthyThreshold is the number of consecutive passed probes that mark an unhealthy server
+	// healthy; zero means 1.
+	HealthyThreshold int
+	// UnhealthyThreshold is the number of consecutive failed probes that mark a healthy server
+	// unhealthy; zero means 1.
+	UnhealthyThreshold int
+	// MaxBackoff enables exponential back-off for unhealthy servers: the interval doubles with every
+	// failed probe up to MaxBackoff. Zero probes them at Interval.
+	MaxBackoff time.Duration
+}
+
+// StatusRange is an inclusive range of HTTP status codes.
+type StatusRange struct {
+	Min int
+	Max int
+}
+
+// Contains reports whether the status code lies within the range.
+func (r StatusRange) Contains(status int) bool {
+	return status >= r.Min && status <= r.Max
+}
+
+// Prober checks whether a backend server is healthy.
+type Prober interface {
+	// Probe returns nil if the server is healthy and an error describing the failure otherwise.
+	Probe(ctx context.Context, server *domain.Server) error
+}
+
+// NewProber creates the prober of the type selected by opts.
+func NewProber(opts HealthCheckOptions) (Prober, error) {
+	switch opts.Type {
+	case "", ProbeHTTP:
+		return NewHTTPProber(opts)
+	case ProbeTCP:
+		return tcpProber{}, nil
+	case ProbeGRPC:
+		return grpcProber{service: opts.Service, authority: opts.Host}, nil
+	case ProbeExec:
+		if len(opts.Command) == 0 {
+			return nil, errors.New("exec health check requires a command")
+		}
+		return execProber{command: opts.Command}, nil
+	}
+	return nil, fmt.Errorf("unknown health check type %q", opts.Type)
+}
+
+// healthCheckClient sends the requests of HTTP probes. Redirects are not followed, so the status of the
+// backend itself is checked rather than that of wherever it redirects to.
+var healthCheckClient = &http.Client{
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// httpProber checks backends by sending them an HTTP request.
+type httpProber struct {
+	opts      HealthCheckOptions
+	path      *url.URL
+	bodyRegex *regexp.Regexp
+	client    *http.Client
+}
+
+// NewHTTPProber creates a prober that checks backends with the HTTP request described by opts.
+func NewHTTPProber(opts HealthCheckOptions) (Prober, error) {
+	p := &httpProber{opts: opts, client: healthCheckClient}
+	if p.opts.Method == "" {
+		p.opts.Method = http.MethodHead
+		if opts.BodyContains != "" || opts.BodyRegex != "" {
+			p.opts.Method = http.MethodGet
+		}
+	}
+	if opts.Path != "" {
+		path, err := url.Parse(opts.Path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid health check path: %w", err)
+		}
+		p.path = path
+	}
+	if opts.BodyRegex != "" {
+		bodyRegex, err := regexp.Compile(opts.BodyRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid health check body regex: %w", err)
+		}
+		p.bodyRegex = bodyRegex
+	}
+	return p, nil
+}
+
+// Probe implements Prober.
+func (p *httpProber) Probe(ctx context.Context, server *domain.Server) error {
+	target := server.URL
+	if p.path != nil {
+		target = server.URL.ResolveReference(p.path)
+	}
+	req, err := http.NewRequestWithContext(ctx, p.opts.Method, target.String(), http.NoBody)
+	if err != nil {
+		return err
+	}
+	for name, value := range p.opts.Headers {
+		req.Header.Set(name, value)
+	}
+	if p.opts.Host != "" {
+		req.Host = p.opts.Host
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			log.Printf("Error closing response body: %v", closeErr)
+		}
+	}()
+
+	if !p.statusExpected(resp.StatusCode) {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	if p.opts.BodyContains == "" && p.bodyRegex == nil {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxHealthCheckBody))
+	if err != nil {
+		return fmt.Errorf("error reading body: %w", err)
+	}
+	if p.opts.BodyContains != "" && !strings.Contains(string(body), p.opts.BodyContains) {
+		return fmt.Errorf("body does not contain %q", p.opts.BodyContains)
+	}
+	if p.bodyRegex != nil && !p.bodyRegex.Match(body) {
+		return fmt.Errorf("body does not match %q", p.opts.BodyRegex)
+	}
+	return nil
+}
+
+// statusExpected reports whether a response status counts as healthy.
+func (p *httpProber) statusExpected(status int) bool {
+	if len(p.opts.ExpectedStatus) == 0 {
+		return status == http.StatusOK
+	}
+	for _, statusRange := range p.opts.ExpectedStatus {
+		if statusRange.Contains(status) {
+			return true
+		}
+	}
+	return false
+}
+
+// tcpProber checks backends by opening a TCP connection to them.
+type tcpProber struct{}
+
+// Probe implements Prober.
+func (tcpProber) Probe(ctx context.Context, server *domain.Server) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", backendAddress(server.URL))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// execProber checks backends by running a local command. The command learns which backend to check
+// from the BREEZEGATE_BACKEND_URL, BREEZEGATE_BACKEND_HOST and BREEZEGATE_BACKEND_PORT environment
+// variables.
+type execProber struct {
+	command []string
+}
+
+// Probe implements Prober.
+func (p execProber) Probe(ctx context.Context, server *domain.Server) error {
+	host, port, err := net.SplitHostPort(backendAddress(server.URL))
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, p.command[0], p.command[1:]...) //nolint:gosec // trusted configuration
+	cmd.Env = append(os.Environ(),
+		"BREEZEGATE_BACKEND_URL="+server.URL.String(),
+		"BREEZEGATE_BACKEND_HOST="+host,
+		"BREEZEGATE_BACKEND_PORT="+port,
+	)
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	if len(output) > maxExecOutput {
+		output = output[:maxExecOutput]
+	}
+	if message := strings.TrimSpace(string(output)); message != "" {
+		return fmt.Errorf("%w: %s", err, message)
+	}
+	return err
+}
+
+// backendAddress returns the host and port of a backend URL, with the default port of its scheme if
+// the URL has none.
+func backendAddress(backendURL *url.URL) string {
+	if backendURL.Port() != "" {
+		return backendURL.Host
+	}
+	port := "80"
+	if backendURL.Scheme == "https" {
+		port = "443"
+	}
+	return net.JoinHostPort(backendURL.Hostname(), port)
+}
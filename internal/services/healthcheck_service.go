@@ -6,7 +6,6 @@ package services
 import (
 	"context"
 	"log"
-	"net/http"
 	"time"
 
 	"github.com/thetonbr/breezegate/internal/domain"
@@ -16,42 +15,138 @@ const (
 	healthCheckTimeout = 5 * time.Second
 )
 
-// HealthCheck performs periodic health checks on a backend server at specified intervals.
-func HealthCheck(server *domain.Server, interval time.Duration) {
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		// Perform a HEAD request to check if the server is responding
-		ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
-		req, err := http.NewRequestWithContext(ctx, http.MethodHead, server.URL.String(), http.NoBody)
-		if err != nil {
-			cancel()
-			log.Printf("Health check failed for %s. Marking server as unhealthy\n", server.URL.String())
-			server.SetHealthStatus(false)
-			continue
+// HealthCheck performs periodic health checks on a backend server at specified intervals
+// until the context is canceled, starting right away. Each check is a HEAD request to the
+// server's URL that must return status 200.
+func HealthCheck(ctx context.Context, server *domain.Server, interval time.Duration) {
+	HealthCheckWithOptions(ctx, server, HealthCheckOptions{Interval: interval})
+}
+
+// HealthCheckWithOptions performs periodic health checks on a backend server as described by opts
+// until the context is canceled. The first probe runs immediately, so a new server does not keep its
+// assumed status for a whole interval. The server only changes state after HealthyThreshold
+// consecutive passed or UnhealthyThreshold consecutive failed probes.
+func HealthCheckWithOptions(ctx context.Context, server *domain.Server, opts HealthCheckOptions) {
+	checkHealth(ctx, server, opts, false)
+}
+
+// checkHealth runs the health check of HealthCheckWithOptions. An initial check is the first one of a
+// server that has never been checked: its first probe decides the health status on its own, so a
+// server assumed healthy or unhealthy is corrected without waiting for the thresholds.
+func checkHealth(ctx context.Context, server *domain.Server, opts HealthCheckOptions, initial bool) {
+	prober, err := NewProber(opts)
+	if err != nil {
+		log.Printf("Health check for %s not started: %s", server.URL.String(), err.Error())
+		return
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = healthCheckTimeout
+	}
+	tracker := newHealthTracker(server, opts, initial)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
 		}
 
-		resp, err := http.DefaultClient.Do(req)
+		probeCtx, cancel := context.WithTimeout(ctx, timeout)
+		err = prober.Probe(probeCtx, server)
 		cancel()
-		if err != nil {
-			// Mark the server as unhealthy
-			log.Printf("Health check failed for %s. Marking server as unhealthy\n", server.URL.String())
-			server.SetHealthStatus(false)
-			continue
+		if ctx.Err() != nil {
+			// Shutting down; the probe was aborted rather than failed
+			return
 		}
-		if resp.Body != nil {
-			if closeErr := resp.Body.Close(); closeErr != nil {
-				log.Printf("Error closing response body: %v", closeErr)
-			}
+		tracker.observe(err)
+		timer.Reset(tracker.nextDelay())
+	}
+}
+
+// healthTracker turns probe results into the health status of a server, counting consecutive
+// results so that a single dropped probe does not make the server flap.
+type healthTracker struct {
+	server  *domain.Server
+	opts    HealthCheckOptions
+	healthy bool
+	// undecided makes the next result decide the health status regardless of the thresholds.
+	undecided bool
+	successes int
+	failures  int
+}
+
+func newHealthTracker(server *domain.Server, opts HealthCheckOptions, undecided bool) *healthTracker {
+	opts.HealthyThreshold = max(opts.HealthyThreshold, 1)
+	opts.UnhealthyThreshold = max(opts.UnhealthyThreshold, 1)
+	return &healthTracker{server: server, opts: opts, healthy: server.CheckedHealthStatus(), undecided: undecided}
+}
+
+// observe records the result of a probe and updates the server once a threshold is reached.
+func (t *healthTracker) observe(err error) {
+	target := t.server.URL.String()
+	if t.undecided {
+		t.undecided = false
+		t.decide(target, err)
+		return
+	}
+	if err != nil {
+		t.successes = 0
+		t.failures++
+		switch {
+		case t.healthy && t.failures >= t.opts.UnhealthyThreshold:
+			log.Printf("Health check failed for %s: %s. Marking server as unhealthy\n", target, err.Error())
+			t.healthy = false
+			t.server.SetHealthStatus(false)
+		case t.healthy:
+			log.Printf("Health check failed for %s: %s (%d of %d)\n",
+				target, err.Error(), t.failures, t.opts.UnhealthyThreshold)
+		default:
+			log.Printf("Health check failed for %s: %s\n", target, err.Error())
 		}
-		if resp.StatusCode != http.StatusOK {
-			// Mark the server as unhealthy
-			log.Printf("Health check failed for %s. Marking server as unhealthy\n", server.URL.String())
-			server.SetHealthStatus(false)
-		} else {
-			// Mark the server as healthy
-			server.SetHealthStatus(true)
+		return
+	}
+
+	t.failures = 0
+	t.successes++
+	if !t.healthy && t.successes >= t.opts.HealthyThreshold {
+		log.Printf("Health check passed for %s. Marking server as healthy\n", target)
+		t.healthy = true
+	}
+	// Also restores a server whose status was changed elsewhere while it kept passing
+	if t.healthy {
+		t.server.SetHealthStatus(true)
+	}
+}
+
+// decide sets the health status of a server that has never been checked from its first result.
+func (t *healthTracker) decide(target string, err error) {
+	t.healthy = err == nil
+	if err != nil {
+		t.failures = 1
+		log.Printf("Health check failed for %s: %s. Marking server as unhealthy\n", target, err.Error())
+	} else {
+		t.successes = 1
+		log.Printf("Health check passed for %s. Marking server as healthy\n", target)
+	}
+	t.server.SetHealthStatus(t.healthy)
+}
+
+// nextDelay returns the time until the next probe. Servers that are down are probed less often the
+// longer they fail, up to MaxBackoff, unless back-off is disabled.
+func (t *healthTracker) nextDelay() time.Duration {
+	delay := t.opts.Interval
+	if t.healthy || t.opts.MaxBackoff <= delay {
+		return delay
+	}
+	for range t.failures - 1 {
+		delay *= 2
+		if delay >= t.opts.MaxBackoff {
+			return t.opts.MaxBackoff
 		}
 	}
+	return delay
 }
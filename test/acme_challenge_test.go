@@ -0,0 +1,146 @@
+package test
+
+import (
+	"crypto/tls"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-acme/lego/v4/challenge/tlsalpn01"
+
+	"github.com/thetonbr/breezegate/internal/handlers"
+	"github.com/thetonbr/breezegate/internal/services"
+)
+
+func TestACMEChallengeHandler(t *testing.T) {
+	provider := services.NewHTTPChallengeProvider()
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("proxied"))
+	})
+	handler := handlers.NewACMEChallengeHandler(provider, next)
+
+	if err := provider.Present("example.com", "token-1", "token-1.thumbprint"); err != nil {
+		t.Fatalf("Failed to present challenge: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "Pending token", path: "/.well-known/acme-challenge/token-1", expectedStatus: http.StatusOK, expectedBody: "token-1.thumbprint"},
+		{name: "Unknown token", path: "/.well-known/acme-challenge/token-2", expectedStatus: http.StatusOK, expectedBody: "proxied"},
+		{name: "Other path", path: "/api", expectedStatus: http.StatusOK, expectedBody: "proxied"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com"+tt.path, http.NoBody))
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedBody != "" && w.Body.String() != tt.expectedBody {
+				t.Errorf("Expected body %q, got %q", tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+
+	if err := provider.CleanUp("example.com", "token-1", "token-1.thumbprint"); err != nil {
+		t.Fatalf("Failed to clean up challenge: %v", err)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com/.well-known/acme-challenge/token-1", http.NoBody))
+	if w.Body.String() != "proxied" {
+		t.Errorf("Expected the request to be proxied after clean up, got %q", w.Body.String())
+	}
+}
+
+func TestTLSALPNChallengeProvider(t *testing.T) {
+	store := services.NewCertificateStore()
+	store.Put("example.com", newTestCertificate(t, time.Hour, "example.com"))
+	provider := services.NewTLSALPNChallengeProvider(store)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	ts := httptest.NewUnstartedServer(handler)
+	ts.TLS = handlers.NewTLSServer("", store, handler).TLSConfig
+	ts.StartTLS()
+	defer ts.Close()
+
+	dialACME := func() (*tls.Conn, error) {
+		return tls.Dial("tcp", ts.Listener.Addr().String(), &tls.Config{
+			ServerName:         "example.com",
+			NextProtos:         []string{tlsalpn01.ACMETLS1Protocol},
+			InsecureSkipVerify: true, //nolint:gosec // challenge certificates are self-signed
+		})
+	}
+
+	if err := provider.Present("example.com", "token", "token.thumbprint"); err != nil {
+		t.Fatalf("Failed to present challenge: %v", err)
+	}
+	conn, err := dialACME()
+	if err != nil {
+		t.Fatalf("Challenge handshake failed: %v", err)
+	}
+	state := conn.ConnectionState()
+	_ = conn.Close()
+	if state.NegotiatedProtocol != tlsalpn01.ACMETLS1Protocol {
+		t.Errorf("Expected protocol %s, got %q", tlsalpn01.ACMETLS1Protocol, state.NegotiatedProtocol)
+	}
+	if !hasACMEIdentifier(state.PeerCertificates[0].Extensions) {
+		t.Error("Expected challenge certificate with the acmeIdentifier extension")
+	}
+
+	if err := provider.CleanUp("example.com", "token", "token.thumbprint"); err != nil {
+		t.Fatalf("Failed to clean up challenge: %v", err)
+	}
+	if conn, err := dialACME(); err == nil {
+		_ = conn.Close()
+		t.Error("Expected challenge handshake to fail after clean up")
+	}
+}
+
+// acmeIdentifierOID is the id-pe-acmeIdentifier extension from RFC 8737.
+var acmeIdentifierOID = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+
+func hasACMEIdentifier(extensions []pkix.Extension) bool {
+	for _, ext := range extensions {
+		if ext.Id.Equal(acmeIdentifierOID) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestParseChallengeType(t *testing.T) {
+	tests := []struct {
+		value       string
+		expected    services.ChallengeType
+		expectError bool
+	}{
+		{value: "", expected: services.ChallengeDNS01},
+		{value: "dns-01", expected: services.ChallengeDNS01},
+		{value: "http-01", expected: services.ChallengeHTTP01},
+		{value: "tls-alpn-01", expected: services.ChallengeTLSALPN01},
+		{value: "smtp-01", expectError: true},
+	}
+
+	for _, tt := range tests {
+		challengeType, err := services.ParseChallengeType(tt.value)
+		if tt.expectError {
+			if err == nil {
+				t.Errorf("Expected error for %q", tt.value)
+			}
+			continue
+		}
+		if err != nil || challengeType != tt.expected {
+			t.Errorf("Expected %s for %q, got %s (%v)", tt.expected, tt.value, challengeType, err)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-acme/lego/v4/certcrypto"
+
+	"github.com/thetonbr/breezegate/internal/services"
+)
+
+// fakeACMEServer implements just enough of an ACME directory to register accounts.
+type fakeACMEServer struct {
+	*httptest.Server
+	registrations []map[string]any
+	mu            sync.Mutex
+}
+
+func newFakeACMEServer(t *testing.T) *fakeACMEServer {
+	t.Helper()
+	fake := &fakeACMEServer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/directory", func(w http.ResponseWriter, _ *http.Request) {
+		base := fake.URL
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"newNonce":   base + "/nonce",
+			"newAccount": base + "/account",
+			"newOrder":   base + "/order",
+			"revokeCert": base + "/revoke",
+			"keyChange":  base + "/key-change",
+		})
+	})
+	mux.HandleFunc("/nonce", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Replay-Nonce", "nonce")
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/account", func(w http.ResponseWriter, r *http.Request) {
+		var jws struct {
+			Payload string `json:"payload"`
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &jws); err != nil {
+			t.Errorf("Invalid JWS: %v", err)
+		}
+		payload, err := base64.RawURLEncoding.DecodeString(jws.Payload)
+		if err != nil {
+			t.Errorf("Invalid JWS payload: %v", err)
+		}
+		var registration map[string]any
+		_ = json.Unmarshal(payload, &registration)
+
+		fake.mu.Lock()
+		fake.registrations = append(fake.registrations, registration)
+		fake.mu.Unlock()
+
+		w.Header().Set("Replay-Nonce", "nonce")
+		w.Header().Set("Location", fake.URL+"/account/1")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"status":"valid"}`))
+	})
+	fake.Server = httptest.NewTLSServer(mux)
+	return fake
+}
+
+func (f *fakeACMEServer) registrationCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.registrations)
+}
+
+func TestNewACMEClient_RegistersOnceAndReusesAccount(t *testing.T) {
+	ca := newFakeACMEServer(t)
+	defer ca.Close()
+
+	storage, err := services.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	opts := services.ACMEOptions{
+		DirectoryURL: ca.URL + "/directory",
+		RootCAs:      ca.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs,
+		KeyType:      certcrypto.EC256,
+		EAB:          &services.ExternalAccountBinding{KeyID: "kid-1", HMACKey: "YnJlZXplZ2F0ZS10ZXN0LWVhYi1obWFjLWtleS0zMmI"},
+		Challenge:    services.ChallengeHTTP01,
+		Provider:     services.NewHTTPChallengeProvider(),
+	}
+
+	if _, err := services.NewACMEClient("admin@example.com", storage, opts); err != nil {
+		t.Fatalf("Failed to create ACME client: %v", err)
+	}
+	if count := ca.registrationCount(); count != 1 {
+		t.Fatalf("Expected 1 registration, got %d", count)
+	}
+	if _, hasEAB := ca.registrations[0]["externalAccountBinding"]; !hasEAB {
+		t.Error("Expected registration to carry an external account binding")
+	}
+
+	account, err := storage.LoadAccount("admin@example.com")
+	if err != nil {
+		t.Fatalf("Expected account to be stored: %v", err)
+	}
+	if account.Registration == nil || account.Registration.URI != ca.URL+"/account/1" {
+		t.Errorf("Expected stored registration URI %s, got %+v", ca.URL+"/account/1", account.Registration)
+	}
+
+	if _, err := services.NewACMEClient("admin@example.com", storage, opts); err != nil {
+		t.Fatalf("Failed to create second ACME client: %v", err)
+	}
+	if count := ca.registrationCount(); count != 1 {
+		t.Errorf("Expected stored account to be reused, got %d registrations", count)
+	}
+}
+
+func TestACMEClient_ObtainCertificateReusesStoredCertificate(t *testing.T) {
+	ca := newFakeACMEServer(t)
+	defer ca.Close()
+	opts := services.ACMEOptions{
+		DirectoryURL: ca.URL + "/directory",
+		RootCAs:      ca.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs,
+		KeyType:      certcrypto.EC256,
+		RenewBefore:  24 * time.Hour,
+		Challenge:    services.ChallengeHTTP01,
+		Provider:     services.NewHTTPChallengeProvider(),
+	}
+
+	tests := []struct {
+		name         string
+		validFor     time.Duration
+		storedNames  []string
+		expectReused bool
+	}{
+		{name: "Valid Certificate", validFor: 90 * 24 * time.Hour, storedNames: []string{"example.com", "www.example.com"}, expectReused: true},
+		{name: "Within Renewal Window", validFor: time.Hour, storedNames: []string{"example.com", "www.example.com"}},
+		{name: "Missing Name", validFor: 90 * 24 * time.Hour, storedNames: []string{"example.com"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage, err := services.NewFileStorage(t.TempDir())
+			if err != nil {
+				t.Fatalf("Failed to create storage: %v", err)
+			}
+			stored := newTestCertificate(t, tt.validFor, tt.storedNames...)
+			certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: stored.Certificate[0]})
+			if err := storage.SaveCertificate("example.com", certPEM, certcrypto.PEMEncode(stored.PrivateKey)); err != nil {
+				t.Fatalf("Failed to save certificate: %v", err)
+			}
+			client, err := services.NewACMEClient("admin@example.com", storage, opts)
+			if err != nil {
+				t.Fatalf("Failed to create ACME client: %v", err)
+			}
+
+			// The fake CA cannot issue certificates, so only a reused certificate is returned
+			cert, err := client.ObtainCertificate("example.com", "www.example.com")
+			if !tt.expectReused {
+				if err == nil {
+					t.Error("Expected the stored certificate to be reissued")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected the stored certificate to be reused, got %v", err)
+			}
+			if string(cert.Certificate[0]) != string(stored.Certificate[0]) {
+				t.Error("Expected the stored certificate to be returned")
+			}
+		})
+	}
+}
+
+func TestParseKeyType(t *testing.T) {
+	tests := []struct {
+		value       string
+		expected    certcrypto.KeyType
+		expectError bool
+	}{
+		{value: "", expected: certcrypto.RSA2048},
+		{value: "rsa4096", expected: certcrypto.RSA4096},
+		{value: "ec256", expected: certcrypto.EC256},
+		{value: "EC384", expected: certcrypto.EC384},
+		{value: "ed25519", expectError: true},
+	}
+
+	for _, tt := range tests {
+		keyType, err := services.ParseKeyType(tt.value)
+		if tt.expectError {
+			if err == nil {
+				t.Errorf("Expected error for %q", tt.value)
+			}
+			continue
+		}
+		if err != nil || keyType != tt.expected {
+			t.Errorf("Expected %s for %q, got %s (%v)", tt.expected, tt.value, keyType, err)
+		}
+	}
+}
+
+func TestStorageNamespace(t *testing.T) {
+	tests := []struct {
+		directoryURL string
+		expected     string
+	}{
+		{directoryURL: "", expected: "acme-v02.api.letsencrypt.org"},
+		{directoryURL: "https://acme-staging-v02.api.letsencrypt.org/directory", expected: "acme-staging-v02.api.letsencrypt.org"},
+		{directoryURL: "https://localhost:14000/dir", expected: "localhost_14000"},
+	}
+
+	for _, tt := range tests {
+		if namespace := services.StorageNamespace(tt.directoryURL); namespace != tt.expected {
+			t.Errorf("Expected namespace %s for %q, got %s", tt.expected, tt.directoryURL, namespace)
+		}
+	}
+}
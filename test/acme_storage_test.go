@@ -0,0 +1,145 @@
+package test
+
+import (
+	"encoding/pem"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-acme/lego/v4/certcrypto"
+	"github.com/go-acme/lego/v4/registration"
+
+	"github.com/thetonbr/breezegate/internal/services"
+)
+
+func TestFileStorage_Account(t *testing.T) {
+	storage, err := services.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	if _, err := storage.LoadAccount("admin@example.com"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Expected fs.ErrNotExist for a missing account, got %v", err)
+	}
+
+	key, err := certcrypto.GeneratePrivateKey(certcrypto.EC256)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	account := &services.ACMEAccount{
+		Email:        "admin@example.com",
+		Registration: &registration.Resource{URI: "https://acme.test/acct/1"},
+		KeyPEM:       certcrypto.PEMEncode(key),
+	}
+	if err := storage.SaveAccount(account); err != nil {
+		t.Fatalf("Failed to save account: %v", err)
+	}
+
+	loaded, err := storage.LoadAccount("admin@example.com")
+	if err != nil {
+		t.Fatalf("Failed to load account: %v", err)
+	}
+	if loaded.Registration == nil || loaded.Registration.URI != account.Registration.URI {
+		t.Errorf("Expected registration %s, got %+v", account.Registration.URI, loaded.Registration)
+	}
+	if string(loaded.KeyPEM) != string(account.KeyPEM) {
+		t.Error("Expected stored account key to round-trip")
+	}
+}
+
+func TestFileStorage_Certificate(t *testing.T) {
+	storage, err := services.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	if _, err := storage.LoadCertificate("*.example.com"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Expected fs.ErrNotExist for a missing certificate, got %v", err)
+	}
+
+	cert := newTestCertificate(t, time.Hour, "*.example.com")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	if err := storage.SaveCertificate("*.example.com", certPEM, certcrypto.PEMEncode(cert.PrivateKey)); err != nil {
+		t.Fatalf("Failed to save certificate: %v", err)
+	}
+
+	loaded, err := storage.LoadCertificate("*.example.com")
+	if err != nil {
+		t.Fatalf("Failed to load certificate: %v", err)
+	}
+	if string(loaded.Certificate[0]) != string(cert.Certificate[0]) {
+		t.Error("Expected stored certificate to round-trip")
+	}
+}
+
+func TestFileStorage_Lock(t *testing.T) {
+	storage, err := services.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	unlock, err := storage.Lock("certificate-example.com")
+	if err != nil {
+		t.Fatalf("Failed to acquire lock: %v", err)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		unlockSecond, err := storage.Lock("certificate-example.com")
+		if err != nil {
+			t.Errorf("Failed to acquire lock: %v", err)
+			return
+		}
+		unlockSecond()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("Expected second lock to wait for the first to be released")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	unlock()
+	select {
+	case <-acquired:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected second lock to be acquired after release")
+	}
+}
+
+func TestFileStorage_LockIgnoresLeftoverLockFile(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := services.NewFileStorage(dir)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	// A crashed process leaves its lock file behind, but not the lock on it
+	if err := os.MkdirAll(filepath.Join(dir, "locks"), 0o700); err != nil {
+		t.Fatalf("Failed to create lock directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "locks", "certificate-example.com.lock"), []byte("12345\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write lock file: %v", err)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		unlock, err := storage.Lock("certificate-example.com")
+		if err != nil {
+			t.Errorf("Failed to acquire lock: %v", err)
+			return
+		}
+		unlock()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a leftover lock file not to block the lock")
+	}
+}
@@ -0,0 +1,368 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thetonbr/breezegate/internal/config"
+	"github.com/thetonbr/breezegate/internal/handlers"
+	"github.com/thetonbr/breezegate/internal/services"
+)
+
+// fakeRuntime keeps the configuration applied through the admin API in memory.
+type fakeRuntime struct {
+	cfg     config.Config
+	applied int
+	mu      sync.Mutex
+}
+
+func (f *fakeRuntime) Config() config.Config {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.cfg
+}
+
+func (f *fakeRuntime) Update(edit func(cfg *config.Config) error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	cfg := f.cfg.Clone()
+	if err := edit(&cfg); err != nil {
+		return err
+	}
+	f.cfg = cfg
+	f.applied++
+	return nil
+}
+
+func newAdminTestConfig() config.Config {
+	return config.Config{
+		Port:                ":8080",
+		HealthCheckInterval: "10s",
+		Admin:               &config.Admin{Address: "127.0.0.1:9090", Token: "secret"},
+		Domains: []config.Domain{
+			{
+				DomainName: "example.com",
+				Routes: []config.Route{
+					{Path: "/api", Backends: []config.Backend{{URL: "http://backend1:8080"}}},
+				},
+			},
+		},
+	}
+}
+
+func newAdminTestHandler(t *testing.T) (*handlers.AdminHandler, *fakeRuntime, *services.BackendPool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	pool := services.NewBackendPool(ctx, time.Hour)
+	// The first probe runs right away; one that always passes leaves health to the admin API
+	alwaysHealthy := services.HealthCheckOptions{Type: services.ProbeExec, Command: []string{"true"}}
+	if _, err := pool.Prepare("http://backend1:8080", false); err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	pool.SetHealthChecks(map[string]services.HealthCheckOptions{"http://backend1:8080": alwaysHealthy})
+	runtime := &fakeRuntime{cfg: newAdminTestConfig()}
+	return handlers.NewAdminHandler(runtime, pool, "secret"), runtime, pool
+}
+
+func adminRequest(handler http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdminHandler_RequiresToken(t *testing.T) {
+	handler, _, _ := newAdminTestHandler(t)
+
+	tests := []struct {
+		name           string
+		authorization  string
+		expectedStatus int
+	}{
+		{name: "Missing Token", authorization: "", expectedStatus: http.StatusUnauthorized},
+		{name: "Wrong Token", authorization: "Bearer wrong", expectedStatus: http.StatusUnauthorized},
+		{name: "Valid Token", authorization: "Bearer secret", expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/config", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+		})
+	}
+}
+
+func TestAdminHandler_EditsConfiguration(t *testing.T) {
+	handler, runtime, _ := newAdminTestHandler(t)
+
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "Add Domain",
+			method:         http.MethodPost,
+			target:         "/domains",
+			body:           `{"domainName":"other.com","routes":[{"path":"/","backends":[{"url":"http://backend2:8080"}]}]}`,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "Duplicate Domain",
+			method:         http.MethodPost,
+			target:         "/domains",
+			body:           `{"domainName":"example.com","routes":[{"path":"/","backends":[{"url":"http://backend2:8080"}]}]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Add Route",
+			method:         http.MethodPost,
+			target:         "/domains/example.com/routes",
+			body:           `{"path":"/web","backends":[{"url":"http://backend3:8080"}]}`,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "Route Without Backends",
+			method:         http.MethodPut,
+			target:         "/domains/example.com/routes?path=/web",
+			body:           `{"path":"/web","backends":[]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Add Backend",
+			method:         http.MethodPost,
+			target:         "/domains/example.com/routes/backends?path=/api",
+			body:           `{"url":"http://backend4:8080"}`,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "Remove Backend",
+			method:         http.MethodDelete,
+			target:         "/domains/example.com/routes/backends?path=/api&url=http://backend1:8080",
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "Unknown Route",
+			method:         http.MethodDelete,
+			target:         "/domains/example.com/routes?path=/missing",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Delete Domain",
+			method:         http.MethodDelete,
+			target:         "/domains/other.com",
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "Unknown Domain",
+			method:         http.MethodGet,
+			target:         "/domains/missing.com",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Unknown Field",
+			method:         http.MethodPost,
+			target:         "/domains",
+			body:           `{"domain":"typo.com"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := adminRequest(handler, tt.method, tt.target, tt.body)
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	cfg := runtime.Config()
+	if runtime.applied != 5 {
+		t.Errorf("Expected 5 applied changes, got %d", runtime.applied)
+	}
+	if len(cfg.Domains) != 1 {
+		t.Fatalf("Expected 1 domain, got %d", len(cfg.Domains))
+	}
+	routes := cfg.Domains[0].Routes
+	if len(routes) != 2 {
+		t.Fatalf("Expected 2 routes, got %d", len(routes))
+	}
+	if len(routes[0].Backends) != 1 || routes[0].Backends[0].URL != "http://backend4:8080" {
+		t.Errorf("Expected /api to only have backend4, got %+v", routes[0].Backends)
+	}
+}
+
+func TestAdminHandler_ConcurrentEditsKeepEachOther(t *testing.T) {
+	handler, runtime, _ := newAdminTestHandler(t)
+
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"url":"http://backend%d:8080"}`, i+10)
+			rec := adminRequest(handler, http.MethodPost, "/domains/example.com/routes/backends?path=/api", body)
+			if rec.Code != http.StatusCreated {
+				t.Errorf("Expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+			}
+		}()
+	}
+	wg.Wait()
+
+	if backends := runtime.Config().Domains[0].Routes[0].Backends; len(backends) != 11 {
+		t.Errorf("Expected 11 backends, got %d", len(backends))
+	}
+}
+
+func TestAdminHandler_DumpsConfigurationWithoutSecrets(t *testing.T) {
+	handler, runtime, _ := newAdminTestHandler(t)
+
+	rec := adminRequest(handler, http.MethodGet, "/config", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	var cfg config.Config
+	if err := json.Unmarshal(rec.Body.Bytes(), &cfg); err != nil {
+		t.Fatalf("Failed to decode config: %v", err)
+	}
+	if len(cfg.Domains) != 1 || cfg.Domains[0].DomainName != "example.com" {
+		t.Errorf("Expected the running domains, got %+v", cfg.Domains)
+	}
+	if cfg.Admin == nil || cfg.Admin.Token == "secret" {
+		t.Error("Expected the admin token to be redacted")
+	}
+	if runtime.Config().Admin.Token != "secret" {
+		t.Error("Expected redaction not to change the running configuration")
+	}
+}
+
+func TestAdminHandler_ManagesBackends(t *testing.T) {
+	handler, runtime, pool := newAdminTestHandler(t)
+	server := pool.Lookup("http://backend1:8080")
+
+	tests := []struct {
+		name            string
+		method          string
+		target          string
+		body            string
+		expectedStatus  int
+		expectedHealthy bool
+		expectedForced  bool
+		expectedState   string
+	}{
+		{
+			name:            "Drain",
+			method:          http.MethodPost,
+			target:          "/backends/drain",
+			body:            `{"url":"http://backend1:8080"}`,
+			expectedStatus:  http.StatusOK,
+			expectedHealthy: true,
+			expectedState:   "draining",
+		},
+		{
+			name:            "Undrain",
+			method:          http.MethodPost,
+			target:          "/backends/undrain",
+			body:            `{"url":"http://backend1:8080"}`,
+			expectedStatus:  http.StatusOK,
+			expectedHealthy: true,
+			expectedState:   "active",
+		},
+		{
+			name:            "Disable",
+			method:          http.MethodPost,
+			target:          "/backends/disable",
+			body:            `{"url":"http://backend1:8080"}`,
+			expectedStatus:  http.StatusOK,
+			expectedHealthy: true,
+			expectedState:   "disabled",
+		},
+		{
+			name:           "Force Unhealthy",
+			method:         http.MethodPut,
+			target:         "/backends/health",
+			body:           `{"url":"http://backend1:8080","healthy":false}`,
+			expectedStatus: http.StatusOK,
+			expectedForced: true,
+			expectedState:  "disabled",
+		},
+		{
+			name:            "Clear Forced Health",
+			method:          http.MethodPut,
+			target:          "/backends/health",
+			body:            `{"url":"http://backend1:8080","healthy":null}`,
+			expectedStatus:  http.StatusOK,
+			expectedHealthy: true,
+			expectedState:   "disabled",
+		},
+		{
+			name:            "Set Weight",
+			method:          http.MethodPut,
+			target:          "/backends/weight",
+			body:            `{"url":"http://backend1:8080","weight":3}`,
+			expectedStatus:  http.StatusOK,
+			expectedHealthy: true,
+			expectedState:   "disabled",
+		},
+		{
+			name:            "Unknown Backend",
+			method:          http.MethodPost,
+			target:          "/backends/drain",
+			body:            `{"url":"http://missing:8080"}`,
+			expectedStatus:  http.StatusNotFound,
+			expectedHealthy: true,
+			expectedState:   "disabled",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := adminRequest(handler, tt.method, tt.target, tt.body)
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if server.GetHealthStatus() != tt.expectedHealthy {
+				t.Errorf("Expected healthy %v, got %v", tt.expectedHealthy, server.GetHealthStatus())
+			}
+			if server.IsHealthForced() != tt.expectedForced {
+				t.Errorf("Expected forced %v, got %v", tt.expectedForced, server.IsHealthForced())
+			}
+			// The state is changed in the configuration and set on the server when it is applied
+			state := runtime.Config().Domains[0].Routes[0].Backends[0].State
+			if state != tt.expectedState {
+				t.Errorf("Expected configured state %q, got %q", tt.expectedState, state)
+			}
+		})
+	}
+
+	if weight := runtime.Config().Domains[0].Routes[0].Backends[0].Weight; weight != 3 {
+		t.Errorf("Expected configured weight 3, got %d", weight)
+	}
+
+	rec := adminRequest(handler, http.MethodGet, "/backends", "")
+	var statuses []map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &statuses); err != nil {
+		t.Fatalf("Failed to decode backends: %v", err)
+	}
+	if len(statuses) != 1 || statuses[0]["url"] != "http://backend1:8080" {
+		t.Errorf("Expected backend1 to be listed, got %v", statuses)
+	}
+}
@@ -0,0 +1,175 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/thetonbr/breezegate/internal/domain"
+)
+
+func newAffinityLoadBalancer(t *testing.T, cookie domain.AffinityCookie, key string, backends []*domain.Server) *domain.LoadBalancer {
+	lb := domain.NewLoadBalancer()
+	opts := domain.RouteOptions{Affinity: domain.NewAffinity(cookie, []byte(key))}
+	if err := lb.AddHostRouteWithOptions("example.com", "/", domain.MatchPrefix, opts, backends); err != nil {
+		t.Fatalf("Failed to add route: %v", err)
+	}
+	return lb
+}
+
+func requestWithCookie(cookie *http.Cookie) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	return req
+}
+
+func TestAffinity_PinsClientToBackend(t *testing.T) {
+	backends := newRingBackends(3)
+	lb := newAffinityLoadBalancer(t, domain.AffinityCookie{}, "secret", backends)
+
+	first, cookie := lb.SelectBackend(requestWithCookie(nil))
+	if first == nil || cookie == nil {
+		t.Fatalf("Expected a backend and an affinity cookie, got %v and %v", first, cookie)
+	}
+	if cookie.Name != domain.DefaultAffinityCookieName {
+		t.Errorf("Expected cookie name %s, got %s", domain.DefaultAffinityCookieName, cookie.Name)
+	}
+	for range 5 {
+		if got, _ := lb.SelectBackend(requestWithCookie(cookie)); got != first {
+			t.Fatalf("Expected pinned backend %s, got %v", first.URL, got)
+		}
+	}
+
+	// A pinned backend that becomes unhealthy is replaced, and the new cookie pins the replacement
+	first.SetHealthStatus(false)
+	replacement, next := lb.SelectBackend(requestWithCookie(cookie))
+	if replacement == nil || replacement == first {
+		t.Fatalf("Expected another backend while the pinned one is unhealthy, got %v", replacement)
+	}
+	first.SetHealthStatus(true)
+	if got, _ := lb.SelectBackend(requestWithCookie(next)); got != replacement {
+		t.Errorf("Expected the client to stay on %s, got %v", replacement.URL, got)
+	}
+}
+
+func TestAffinity_RejectsForgedCookies(t *testing.T) {
+	backends := newRingBackends(2)
+	lb := newAffinityLoadBalancer(t, domain.AffinityCookie{}, "secret", backends)
+	other := newAffinityLoadBalancer(t, domain.AffinityCookie{}, "other-secret", backends)
+
+	_, cookie := lb.SelectBackend(requestWithCookie(nil))
+	_, foreign := other.SelectBackend(requestWithCookie(nil))
+	pinned, _ := lb.SelectBackend(requestWithCookie(cookie))
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+	}{
+		{name: "Wrong Key", cookie: foreign},
+		{name: "Tampered Value", cookie: &http.Cookie{Name: cookie.Name, Value: "x" + cookie.Value}},
+		{name: "Unsigned", cookie: &http.Cookie{Name: cookie.Name, Value: "backend"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// An invalid cookie is ignored, so requests rotate instead of sticking to one backend
+			seen := make(map[*domain.Server]bool)
+			for range 4 {
+				server, _ := lb.SelectBackend(requestWithCookie(tt.cookie))
+				seen[server] = true
+			}
+			if len(seen) != 2 {
+				t.Errorf("Expected an invalid cookie to be ignored, got backends %v", seen)
+			}
+		})
+	}
+	if pinned == nil {
+		t.Error("Expected a valid cookie to pin a backend")
+	}
+}
+
+func TestAffinity_CookieAttributes(t *testing.T) {
+	cookieConfig := domain.AffinityCookie{
+		Name:     "route",
+		TTL:      time.Hour,
+		Secure:   true,
+		HTTPOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	}
+	lb := newAffinityLoadBalancer(t, cookieConfig, "secret", newRingBackends(1))
+
+	_, cookie := lb.SelectBackend(requestWithCookie(nil))
+	if cookie.Name != "route" || cookie.MaxAge != 3600 || cookie.Path != "/" {
+		t.Errorf("Expected cookie route with max age 3600 and path /, got %+v", cookie)
+	}
+	if !cookie.Secure || !cookie.HttpOnly || cookie.SameSite != http.SameSiteStrictMode {
+		t.Errorf("Expected a secure, HTTP-only, strict cookie, got %+v", cookie)
+	}
+}
+
+func TestAffinity_DrainingBackendKeepsClients(t *testing.T) {
+	backends := newRingBackends(2)
+	lb := newAffinityLoadBalancer(t, domain.AffinityCookie{}, "secret", backends)
+
+	pinned, cookie := lb.SelectBackend(requestWithCookie(nil))
+	pinned.SetAdminState(domain.StateDraining, time.Hour)
+	if got, _ := lb.SelectBackend(requestWithCookie(cookie)); got != pinned {
+		t.Errorf("Expected a draining backend to keep its clients, got %v", got)
+	}
+	if got, _ := lb.SelectBackend(requestWithCookie(nil)); got == pinned {
+		t.Error("Expected a draining backend to receive no new clients")
+	}
+
+	pinned.SetAdminState(domain.StateDisabled, 0)
+	if got, _ := lb.SelectBackend(requestWithCookie(cookie)); got == pinned {
+		t.Error("Expected a disabled backend to lose its clients")
+	}
+}
+
+func TestAffinity_CookiesAreScopedToRoutes(t *testing.T) {
+	backends := newRingBackends(4)
+	lb := domain.NewLoadBalancer()
+	routes := []struct {
+		path     string
+		match    domain.MatchType
+		backends []*domain.Server
+	}{
+		{path: "/", match: domain.MatchPrefix, backends: backends[:2]},
+		{path: "/api", match: domain.MatchPrefix, backends: backends[2:]},
+		{path: `^/static/.*$`, match: domain.MatchRegex, backends: backends[:2]},
+	}
+	for _, route := range routes {
+		opts := domain.RouteOptions{Affinity: domain.NewAffinity(domain.AffinityCookie{}, []byte("secret"))}
+		if err := lb.AddHostRouteWithOptions("example.com", route.path, route.match, opts, route.backends); err != nil {
+			t.Fatalf("Failed to add route %s: %v", route.path, err)
+		}
+	}
+
+	rootServer, rootCookie := lb.SelectBackend(httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+	apiServer, apiCookie := lb.SelectBackend(httptest.NewRequest(http.MethodGet, "http://example.com/api/users", nil))
+	_, staticCookie := lb.SelectBackend(httptest.NewRequest(http.MethodGet, "http://example.com/static/site.css", nil))
+	if rootCookie.Path != "/" || apiCookie.Path != "/api" {
+		t.Fatalf("Expected cookie paths / and /api, got %s and %s", rootCookie.Path, apiCookie.Path)
+	}
+	if staticCookie.Name == rootCookie.Name {
+		t.Errorf("Expected the regex route to use a cookie name of its own, got %s", staticCookie.Name)
+	}
+
+	// Requests below /api carry the cookies of both routes
+	for i := 0; i < 4; i++ {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/api/users", nil)
+		req.AddCookie(rootCookie)
+		req.AddCookie(apiCookie)
+		if server, _ := lb.SelectBackend(req); server != apiServer {
+			t.Fatalf("Expected /api to stay pinned to %s, got %s", apiServer.URL, server.URL)
+		}
+		req = httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		req.AddCookie(rootCookie)
+		if server, _ := lb.SelectBackend(req); server != rootServer {
+			t.Fatalf("Expected / to stay pinned to %s, got %s", rootServer.URL, server.URL)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/thetonbr/breezegate/internal/services"
+)
+
+func TestBackendPool_ReusesServers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pool := services.NewBackendPool(ctx, time.Hour)
+
+	first, err := pool.Prepare("http://backend:8080", false)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	first.SetHealthStatus(false)
+	second, err := pool.Prepare("http://backend:8080", false)
+	if err != nil {
+		t.Fatalf("Failed to get server: %v", err)
+	}
+	if first != second {
+		t.Error("Expected the same URL to return the same server")
+	}
+	if second.GetHealthStatus() {
+		t.Error("Expected a reused server to keep its health status")
+	}
+
+	if _, err := pool.Prepare("http://other:8080", false); err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	pool.Retain([]string{"http://other:8080"})
+	if servers := pool.Servers(); len(servers) != 1 {
+		t.Errorf("Expected 1 server after retain, got %d", len(servers))
+	}
+	if server, _ := pool.Prepare("http://backend:8080", false); server == first {
+		t.Error("Expected a removed server to be recreated")
+	}
+}
+
+func TestBackendPool_RetainStopsHealthChecks(t *testing.T) {
+	var checks atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		checks.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pool := services.NewBackendPool(ctx, 10*time.Millisecond)
+	if _, err := pool.Prepare(ts.URL, false); err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	pool.SetHealthChecks(map[string]services.HealthCheckOptions{ts.URL: {}})
+
+	time.Sleep(50 * time.Millisecond)
+	if checks.Load() == 0 {
+		t.Fatal("Expected health checks to run")
+	}
+	pool.Retain(nil)
+	time.Sleep(20 * time.Millisecond)
+	stopped := checks.Load()
+	time.Sleep(50 * time.Millisecond)
+	if checks.Load() != stopped {
+		t.Error("Expected health checks of removed servers to stop")
+	}
+}
+
+func TestBackendPool_FirstCheckDecides(t *testing.T) {
+	tests := []struct {
+		name            string
+		startUnhealthy  bool
+		status          int
+		opts            services.HealthCheckOptions
+		expectedHealthy bool
+	}{
+		{
+			name:            "Start Unhealthy",
+			startUnhealthy:  true,
+			status:          http.StatusOK,
+			opts:            services.HealthCheckOptions{HealthyThreshold: 3},
+			expectedHealthy: true,
+		},
+		{
+			name:            "Start Healthy",
+			status:          http.StatusInternalServerError,
+			opts:            services.HealthCheckOptions{UnhealthyThreshold: 3},
+			expectedHealthy: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, arrived, release := newGatedServer(tt.status)
+			defer ts.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			pool := services.NewBackendPool(ctx, time.Hour)
+			server, err := pool.Prepare(ts.URL, tt.startUnhealthy)
+			if err != nil {
+				t.Fatalf("Failed to create server: %v", err)
+			}
+			pool.SetHealthChecks(map[string]services.HealthCheckOptions{ts.URL: tt.opts})
+
+			<-arrived
+			if server.GetHealthStatus() == tt.expectedHealthy {
+				t.Errorf("Expected healthy %v before the first probe, got %v", !tt.expectedHealthy, tt.expectedHealthy)
+			}
+			release <- struct{}{}
+			// The interval is an hour, so only the first probe can decide despite the threshold
+			deadline := time.Now().Add(2 * time.Second)
+			for server.GetHealthStatus() != tt.expectedHealthy {
+				if time.Now().After(deadline) {
+					t.Fatalf("Expected healthy %v after the first probe, got %v", tt.expectedHealthy, !tt.expectedHealthy)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			if _, err := pool.Prepare(ts.URL, !tt.startUnhealthy); err != nil {
+				t.Fatalf("Failed to get server: %v", err)
+			}
+			if server.GetHealthStatus() != tt.expectedHealthy {
+				t.Error("Expected an existing server to keep its health status")
+			}
+		})
+	}
+}
+
+func TestBackendPool_PrepareDefersHealthChecks(t *testing.T) {
+	var checks atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ready" {
+			checks.Add(1)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pool := services.NewBackendPool(ctx, 10*time.Millisecond)
+	server, err := pool.Prepare(ts.URL, false)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	pool.SetHealthChecks(map[string]services.HealthCheckOptions{ts.URL: {}})
+
+	ready := services.HealthCheckOptions{Path: "/ready"}
+	prepared, err := pool.Prepare(ts.URL, false)
+	if err != nil {
+		t.Fatalf("Failed to prepare server: %v", err)
+	}
+	if prepared != server {
+		t.Error("Expected Prepare to return the existing server")
+	}
+	if _, err := pool.Prepare("http://other:8080", false); err != nil {
+		t.Fatalf("Failed to prepare server: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if checks.Load() != 0 {
+		t.Fatal("Expected Prepare to keep the running health check")
+	}
+
+	// Dropping the prepared configuration removes the server that was never checked
+	pool.Retain([]string{ts.URL})
+	if servers := pool.Servers(); len(servers) != 1 {
+		t.Errorf("Expected 1 server after retain, got %d", len(servers))
+	}
+
+	pool.SetHealthChecks(map[string]services.HealthCheckOptions{ts.URL: ready})
+	time.Sleep(50 * time.Millisecond)
+	if checks.Load() == 0 {
+		t.Error("Expected SetHealthChecks to restart the health check with the new options")
+	}
+}
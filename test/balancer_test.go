@@ -0,0 +1,215 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/thetonbr/breezegate/internal/domain"
+	"github.com/thetonbr/breezegate/internal/handlers"
+)
+
+// headerBalancer picks the backend whose host is named by the X-Backend header.
+type headerBalancer struct{}
+
+func (headerBalancer) Next(r *http.Request, backends []*domain.Server) *domain.Server {
+	for _, server := range backends {
+		if server.URL.Host == r.Header.Get("X-Backend") {
+			return server
+		}
+	}
+	return nil
+}
+
+func TestNewBalancer(t *testing.T) {
+	tests := []struct {
+		name        string
+		algorithm   domain.Algorithm
+		expectError bool
+	}{
+		{name: "Default", algorithm: ""},
+		{name: "Round Robin", algorithm: domain.AlgorithmRoundRobin},
+		{name: "Random", algorithm: domain.AlgorithmRandom},
+		{name: "Least Connections", algorithm: domain.AlgorithmLeastConn},
+		{name: "Power of Two Choices", algorithm: domain.AlgorithmP2C},
+		{name: "Unknown", algorithm: "fastest", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			balancer, err := domain.NewBalancer(tt.algorithm, domain.BalancerOptions{})
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			server := newTestServer("http://a", true)
+			if got := balancer.Next(httptest.NewRequest(http.MethodGet, "/", nil), []*domain.Server{server}); got != server {
+				t.Errorf("Expected the only backend, got %v", got)
+			}
+		})
+	}
+}
+
+func TestRandomBalancer(t *testing.T) {
+	balancer, err := domain.NewBalancer(domain.AlgorithmRandom, domain.BalancerOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create balancer: %v", err)
+	}
+	heavy, light := newWeightedServer("http://heavy", 9), newWeightedServer("http://light", 1)
+	backends := []*domain.Server{heavy, light, newTestServer("http://down", false)}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	counts := make(map[*domain.Server]int)
+	for range 10000 {
+		counts[balancer.Next(req, backends)]++
+	}
+	if counts[heavy]+counts[light] != 10000 {
+		t.Errorf("Expected only available backends to be picked, got %v", counts)
+	}
+	if counts[heavy] < 8500 || counts[heavy] > 9500 {
+		t.Errorf("Expected about 9000 requests for the heavy backend, got %d", counts[heavy])
+	}
+
+	if got := balancer.Next(req, []*domain.Server{newTestServer("http://down", false)}); got != nil {
+		t.Errorf("Expected nil without available backends, got %v", got)
+	}
+}
+
+func TestLoadBalancer_CustomBalancer(t *testing.T) {
+	a, b := newTestServer("http://a", true), newTestServer("http://b", true)
+	lb := domain.NewLoadBalancer()
+	opts := domain.RouteOptions{Balancer: headerBalancer{}}
+	err := lb.AddHostRouteWithOptions("example.com", "/", domain.MatchPrefix, opts, []*domain.Server{a, b})
+	if err != nil {
+		t.Fatalf("Failed to add route: %v", err)
+	}
+
+	for _, expected := range []*domain.Server{b, a, b} {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		req.Header.Set("X-Backend", expected.URL.Host)
+		if got, _ := lb.SelectBackend(req); got != expected {
+			t.Errorf("Expected %s, got %v", expected.URL, got)
+		}
+	}
+}
+
+func newLoadedServer(host string, weight, inFlight int) *domain.Server {
+	server := newWeightedServer(host, weight)
+	for range inFlight {
+		server.StartRequest()
+	}
+	return server
+}
+
+func TestLeastConnBalancer(t *testing.T) {
+	tests := []struct {
+		name     string
+		backends []*domain.Server
+		expected string
+	}{
+		{
+			name:     "Fewest In Flight",
+			backends: []*domain.Server{newLoadedServer("http://a", 1, 3), newLoadedServer("http://b", 1, 1)},
+			expected: "b",
+		},
+		{
+			name:     "Relative To Weight",
+			backends: []*domain.Server{newLoadedServer("http://a", 4, 3), newLoadedServer("http://b", 1, 1)},
+			expected: "a",
+		},
+		{
+			name: "Skips Unavailable",
+			backends: []*domain.Server{
+				newLoadedServer("http://a", 1, 3),
+				newTestServer("http://b", false),
+			},
+			expected: "a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			balancer, err := domain.NewBalancer(domain.AlgorithmLeastConn, domain.BalancerOptions{})
+			if err != nil {
+				t.Fatalf("Failed to create balancer: %v", err)
+			}
+			got := balancer.Next(httptest.NewRequest(http.MethodGet, "/", nil), tt.backends)
+			if got == nil || got.URL.Host != tt.expected {
+				t.Errorf("Expected %s, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestLeastConnBalancer_RotatesTies(t *testing.T) {
+	balancer, err := domain.NewBalancer(domain.AlgorithmLeastConn, domain.BalancerOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create balancer: %v", err)
+	}
+	backends := []*domain.Server{newTestServer("http://a", true), newTestServer("http://b", true)}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	first, second := balancer.Next(req, backends), balancer.Next(req, backends)
+	if first == second {
+		t.Errorf("Expected idle backends to take turns, got %s twice", first.URL)
+	}
+}
+
+func TestP2CBalancer(t *testing.T) {
+	balancer, err := domain.NewBalancer(domain.AlgorithmP2C, domain.BalancerOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create balancer: %v", err)
+	}
+	busy, idle := newLoadedServer("http://busy", 1, 5), newLoadedServer("http://idle", 1, 0)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	// With two backends both are always compared, so the idle one wins every time
+	for range 100 {
+		if got := balancer.Next(req, []*domain.Server{busy, idle}); got != idle {
+			t.Fatalf("Expected the idle backend, got %s", got.URL)
+		}
+	}
+
+	// The most loaded of three backends is never picked, since it loses every comparison
+	third := newLoadedServer("http://third", 1, 1)
+	for range 100 {
+		if got := balancer.Next(req, []*domain.Server{busy, idle, third}); got == busy {
+			t.Fatal("Expected the busiest backend never to be picked")
+		}
+	}
+}
+
+func TestLoadBalancerHandler_CountsInFlightRequests(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		close(started)
+		<-release
+	}))
+	defer backend.Close()
+
+	server := &domain.Server{URL: mustParseURL(backend.URL), IsHealthy: true}
+	lb := domain.NewLoadBalancer()
+	lb.AddRoute("/", []*domain.Server{server})
+	lbHandler := handlers.NewLoadBalancerHandler(lb)
+
+	done := make(chan struct{})
+	go func() {
+		lbHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		close(done)
+	}()
+	<-started
+	if server.InFlight() != 1 {
+		t.Errorf("Expected 1 request in flight, got %d", server.InFlight())
+	}
+	close(release)
+	<-done
+	if server.InFlight() != 0 {
+		t.Errorf("Expected 0 requests in flight, got %d", server.InFlight())
+	}
+}
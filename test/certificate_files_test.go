@@ -0,0 +1,92 @@
+package test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/thetonbr/breezegate/internal/services"
+)
+
+// writeCertificateFiles writes the certificate and its key as PEM files and returns their paths.
+func writeCertificateFiles(t *testing.T, dir string, cert *tls.Certificate) (certFile, keyFile string) {
+	t.Helper()
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	certFile = filepath.Join(dir, "tls.crt")
+	keyFile = filepath.Join(dir, "tls.key")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func TestCertificateFiles_LoadWithChain(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCertificateFiles(t, dir, newTestCertificate(t, time.Hour, "example.com"))
+	intermediate := newTestCertificate(t, time.Hour, "Example Intermediate CA")
+	caFile := filepath.Join(dir, "ca.crt")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: intermediate.Certificate[0]})
+	if err := os.WriteFile(caFile, caPEM, 0o600); err != nil {
+		t.Fatalf("Failed to write CA chain: %v", err)
+	}
+
+	cert, err := services.CertificateFiles{CertFile: certFile, KeyFile: keyFile, CAFile: caFile}.Load()
+	if err != nil {
+		t.Fatalf("Failed to load certificate files: %v", err)
+	}
+	if len(cert.Certificate) != 2 {
+		t.Errorf("Expected certificate followed by its chain, got %d certificates", len(cert.Certificate))
+	}
+
+	if _, err := (services.CertificateFiles{CertFile: certFile}).Load(); err == nil {
+		t.Error("Expected error without a key file")
+	}
+}
+
+func TestCertificateFileWatcher_ReloadsChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCertificateFiles(t, dir, newTestCertificate(t, time.Hour, "example.com", "www.example.com"))
+
+	store := services.NewCertificateStore()
+	files := services.CertificateFiles{CertFile: certFile, KeyFile: keyFile}
+	watcher := services.NewCertificateFileWatcher(store, []string{"example.com", "www.example.com"}, files, 10*time.Millisecond)
+	if err := watcher.Load(); err != nil {
+		t.Fatalf("Failed to load certificate: %v", err)
+	}
+	oldCert := store.Get("www.example.com")
+	if oldCert == nil {
+		t.Fatal("Expected certificate to be stored under its alias")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go watcher.Watch(ctx)
+
+	// Replace the files with a new certificate; the modification time changes with the content
+	newCert := newTestCertificate(t, 2*time.Hour, "example.com", "www.example.com")
+	writeCertificateFiles(t, dir, newCert)
+	future := time.Now().Add(time.Minute)
+	for _, path := range []string{certFile, keyFile} {
+		if err := os.Chtimes(path, future, future); err != nil {
+			t.Fatalf("Failed to touch %s: %v", path, err)
+		}
+	}
+
+	waitForCertificate(t, store, "example.com", func(cert *tls.Certificate) bool { return cert != oldCert })
+	if store.Get("www.example.com") != store.Get("example.com") {
+		t.Error("Expected reloaded certificate to be stored under every name")
+	}
+}
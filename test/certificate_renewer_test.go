@@ -0,0 +1,126 @@
+package test
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thetonbr/breezegate/internal/services"
+)
+
+type fakeIssuer struct {
+	t        *testing.T
+	validFor time.Duration
+	failures int
+	calls    int
+	mu       sync.Mutex
+}
+
+func (f *fakeIssuer) ObtainCertificate(domains ...string) (*tls.Certificate, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.calls <= f.failures {
+		return nil, errors.New("issuance failed")
+	}
+	return newTestCertificate(f.t, f.validFor, domains...), nil
+}
+
+func (f *fakeIssuer) callCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func waitForCertificate(t *testing.T, store *services.CertificateStore, domain string, accept func(*tls.Certificate) bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if cert := store.Get(domain); cert != nil && accept(cert) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Certificate for %s was not installed in time", domain)
+}
+
+func TestCertificateRenewer_IssuesMissingCertificate(t *testing.T) {
+	store := services.NewCertificateStore()
+	renewer := services.NewCertificateRenewer(store, services.RenewalOptions{RenewBefore: time.Hour})
+	issuer := &fakeIssuer{t: t, validFor: 90 * 24 * time.Hour}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go renewer.Watch(ctx, []string{"example.com"}, issuer)
+
+	waitForCertificate(t, store, "example.com", func(*tls.Certificate) bool { return true })
+	time.Sleep(50 * time.Millisecond)
+	if calls := issuer.callCount(); calls != 1 {
+		t.Errorf("Expected a valid certificate to be issued once, got %d calls", calls)
+	}
+}
+
+func TestCertificateRenewer_RenewsExpiringCertificate(t *testing.T) {
+	store := services.NewCertificateStore()
+	oldCert := newTestCertificate(t, time.Hour, "example.com")
+	store.Put("example.com", oldCert)
+
+	renewer := services.NewCertificateRenewer(store, services.RenewalOptions{RenewBefore: 24 * time.Hour})
+	issuer := &fakeIssuer{t: t, validFor: 90 * 24 * time.Hour}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go renewer.Watch(ctx, []string{"example.com"}, issuer)
+
+	waitForCertificate(t, store, "example.com", func(cert *tls.Certificate) bool { return cert != oldCert })
+}
+
+func TestCertificateRenewer_RetriesFailures(t *testing.T) {
+	store := services.NewCertificateStore()
+	renewer := services.NewCertificateRenewer(store, services.RenewalOptions{
+		RetryBase: 10 * time.Millisecond,
+		RetryMax:  40 * time.Millisecond,
+	})
+	issuer := &fakeIssuer{t: t, validFor: 90 * 24 * time.Hour, failures: 3}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go renewer.Watch(ctx, []string{"example.com"}, issuer)
+
+	waitForCertificate(t, store, "example.com", func(*tls.Certificate) bool { return true })
+	if calls := issuer.callCount(); calls != 4 {
+		t.Errorf("Expected 4 issuance attempts, got %d", calls)
+	}
+}
+
+func TestCertificateRenewer_CoversAllNames(t *testing.T) {
+	store := services.NewCertificateStore()
+	oldCert := newTestCertificate(t, 90*24*time.Hour, "example.com")
+	store.Put("example.com", oldCert)
+
+	renewer := services.NewCertificateRenewer(store, services.RenewalOptions{RenewBefore: time.Hour})
+	issuer := &fakeIssuer{t: t, validFor: 90 * 24 * time.Hour}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go renewer.Watch(ctx, []string{"example.com", "www.example.com", "*.example.com"}, issuer)
+
+	// The stored certificate is still valid but lacks the aliases, so one covering all names is issued
+	waitForCertificate(t, store, "example.com", func(cert *tls.Certificate) bool { return cert != oldCert })
+	newCert := store.Get("example.com")
+	for _, name := range []string{"www.example.com", "api.example.com"} {
+		cert, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: name})
+		if err != nil {
+			t.Fatalf("Expected certificate for %s: %v", name, err)
+		}
+		if cert != newCert {
+			t.Errorf("Expected %s to be served the multi-SAN certificate", name)
+		}
+	}
+	if calls := issuer.callCount(); calls != 1 {
+		t.Errorf("Expected 1 issuance, got %d calls", calls)
+	}
+}
@@ -0,0 +1,119 @@
+package test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/thetonbr/breezegate/internal/handlers"
+	"github.com/thetonbr/breezegate/internal/services"
+)
+
+// newTestCertificate creates a self-signed certificate for the given names, valid for the given duration.
+func newTestCertificate(t *testing.T, validFor time.Duration, names ...string) *tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(validFor),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestCertificateStore_GetCertificate(t *testing.T) {
+	store := services.NewCertificateStore()
+	exampleCert := newTestCertificate(t, time.Hour, "example.com")
+	wildcardCert := newTestCertificate(t, time.Hour, "*.other.com")
+	store.Put("example.com", exampleCert)
+	store.Put("*.other.com", wildcardCert)
+
+	tests := []struct {
+		name       string
+		serverName string
+		expected   *tls.Certificate
+	}{
+		{name: "Exact name", serverName: "example.com", expected: exampleCert},
+		{name: "Mixed case name", serverName: "Example.COM", expected: exampleCert},
+		{name: "Wildcard name", serverName: "www.other.com", expected: wildcardCert},
+		{name: "Wildcard does not match apex", serverName: "other.com", expected: nil},
+		{name: "Wildcard does not match two labels", serverName: "a.b.other.com", expected: nil},
+		{name: "No SNI without default", serverName: "", expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: tt.serverName})
+			if tt.expected == nil {
+				if err == nil {
+					t.Error("Expected an error, got a certificate")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if cert != tt.expected {
+				t.Errorf("Expected certificate for %s, got %s", tt.expected.Leaf.Subject.CommonName, cert.Leaf.Subject.CommonName)
+			}
+		})
+	}
+
+	store.SetDefault("example.com")
+	cert, err := store.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil || cert != exampleCert {
+		t.Errorf("Expected default certificate for clients without SNI, got %v (%v)", cert, err)
+	}
+}
+
+func TestTLSServer_SelectsCertificateBySNI(t *testing.T) {
+	store := services.NewCertificateStore()
+	store.Put("a.test", newTestCertificate(t, time.Hour, "a.test"))
+	store.Put("b.test", newTestCertificate(t, time.Hour, "b.test"))
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	ts := httptest.NewUnstartedServer(handler)
+	ts.TLS = handlers.NewTLSServer("", store, handler).TLSConfig
+	ts.StartTLS()
+	defer ts.Close()
+
+	for _, serverName := range []string{"a.test", "b.test"} {
+		conn, err := tls.Dial("tcp", ts.Listener.Addr().String(), &tls.Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: true, //nolint:gosec // self-signed test certificates
+		})
+		if err != nil {
+			t.Fatalf("Handshake for %s failed: %v", serverName, err)
+		}
+		peer := conn.ConnectionState().PeerCertificates[0]
+		if err := conn.Close(); err != nil {
+			t.Errorf("Failed to close connection: %v", err)
+		}
+		if peer.Subject.CommonName != serverName {
+			t.Errorf("Expected certificate for %s, got %s", serverName, peer.Subject.CommonName)
+		}
+	}
+}
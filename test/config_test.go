@@ -109,3 +109,313 @@ func TestLoadConfigInvalidJSON(t *testing.T) {
 		t.Error("Expected error when loading invalid JSON config file")
 	}
 }
+
+func TestLoadConfigSample(t *testing.T) {
+	cfg, err := config.LoadConfig("../config/config.json")
+	if err != nil {
+		t.Fatalf("Expected the sample configuration to be valid, got %v", err)
+	}
+	if backends := len(cfg.Domains[0].Routes[0].Backends); backends != 2 {
+		t.Errorf("Expected 2 backends in the first route, got %d", backends)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	validDomain := func() config.Domain {
+		return config.Domain{
+			DomainName: "example.com",
+			Routes: []config.Route{
+				{Path: "/api", Backends: []config.Backend{{URL: "http://localhost:8081"}}},
+			},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		modify      func(cfg *config.Config)
+		expectError bool
+	}{
+		{name: "Valid config", modify: func(*config.Config) {}},
+		{name: "Missing port", modify: func(cfg *config.Config) { cfg.Port = "" }, expectError: true},
+		{name: "Invalid interval", modify: func(cfg *config.Config) { cfg.HealthCheckInterval = "often" }, expectError: true},
+		{name: "Invalid redirect status", modify: func(cfg *config.Config) { cfg.RedirectStatus = 200 }, expectError: true},
+		{
+			name:        "Duplicate domain",
+			modify:      func(cfg *config.Config) { cfg.Domains = append(cfg.Domains, validDomain()) },
+			expectError: true,
+		},
+		{
+			name:        "Unknown match type",
+			modify:      func(cfg *config.Config) { cfg.Domains[0].Routes[0].Match = "glob" },
+			expectError: true,
+		},
+		{
+			name: "Invalid regex",
+			modify: func(cfg *config.Config) {
+				cfg.Domains[0].Routes[0].Match = "regex"
+				cfg.Domains[0].Routes[0].Path = "^/api/("
+			},
+			expectError: true,
+		},
+		{
+			name:        "Invalid backend URL",
+			modify:      func(cfg *config.Config) { cfg.Domains[0].Routes[0].Backends[0].URL = "localhost:8081" },
+			expectError: true,
+		},
+		{
+			name: "Wildcard with HTTP-01",
+			modify: func(cfg *config.Config) {
+				cfg.Domains[0].UseTLS = true
+				cfg.Domains[0].Challenge = "http-01"
+				cfg.Domains[0].Aliases = []string{"*.example.com"}
+			},
+			expectError: true,
+		},
+		{
+			name:        "Key file without certificate file",
+			modify:      func(cfg *config.Config) { cfg.Domains[0].KeyFile = "tls.key" },
+			expectError: true,
+		},
+		{name: "Key type", modify: func(cfg *config.Config) { cfg.ACME.KeyType = "EC256" }},
+		{name: "Unknown key type", modify: func(cfg *config.Config) { cfg.ACME.KeyType = "ed25519" }, expectError: true},
+		{
+			name: "DNS provider",
+			modify: func(cfg *config.Config) {
+				cfg.ACME.DNSProvider = &config.DNSProvider{
+					Name:    "rfc2136",
+					Options: map[string]string{"nameserver": "127.0.0.1:53", "ttl": "60", "dnsTimeout": "10s"},
+				}
+			},
+		},
+		{
+			name:        "Unknown DNS provider",
+			modify:      func(cfg *config.Config) { cfg.ACME.DNSProvider = &config.DNSProvider{Name: "route66"} },
+			expectError: true,
+		},
+		{
+			name: "Unknown DNS provider option",
+			modify: func(cfg *config.Config) {
+				cfg.Domains[0].DNSProvider = &config.DNSProvider{Options: map[string]string{"apiToken": "secret"}}
+			},
+			expectError: true,
+		},
+		{
+			name:        "Missing DNS provider option",
+			modify:      func(cfg *config.Config) { cfg.ACME.DNSProvider = &config.DNSProvider{Name: "exec"} },
+			expectError: true,
+		},
+		{
+			name: "Invalid DNS provider duration",
+			modify: func(cfg *config.Config) {
+				cfg.ACME.DNSProvider = &config.DNSProvider{
+					Name:    "exec",
+					Options: map[string]string{"program": "/usr/local/bin/dns-hook", "propagationTimeout": "soon"},
+				}
+			},
+			expectError: true,
+		},
+		{
+			name:        "Unknown backend state",
+			modify:      func(cfg *config.Config) { cfg.Domains[0].Routes[0].Backends[0].State = "paused" },
+			expectError: true,
+		},
+		{
+			name:        "Unknown algorithm",
+			modify:      func(cfg *config.Config) { cfg.Domains[0].Routes[0].Algorithm = "fastest" },
+			expectError: true,
+		},
+		{
+			name: "Hash key without ring hash",
+			modify: func(cfg *config.Config) {
+				cfg.Domains[0].Routes[0].HashKey = &config.HashKey{Source: "header", Name: "X-User"}
+			},
+			expectError: true,
+		},
+		{
+			name: "Hash header without name",
+			modify: func(cfg *config.Config) {
+				cfg.Domains[0].Routes[0].Algorithm = "ring_hash"
+				cfg.Domains[0].Routes[0].HashKey = &config.HashKey{Source: "header"}
+			},
+			expectError: true,
+		},
+		{
+			name: "Affinity same site none without secure",
+			modify: func(cfg *config.Config) {
+				cfg.Domains[0].Routes[0].Affinity = &config.Affinity{SameSite: "none"}
+			},
+			expectError: true,
+		},
+		{
+			name: "Invalid affinity TTL",
+			modify: func(cfg *config.Config) {
+				cfg.Domains[0].Routes[0].Affinity = &config.Affinity{TTL: "forever"}
+			},
+			expectError: true,
+		},
+		{
+			name: "Health check body with HEAD",
+			modify: func(cfg *config.Config) {
+				cfg.Domains[0].Routes[0].HealthCheck = &config.HealthCheck{Method: "HEAD", BodyContains: "ok"}
+			},
+			expectError: true,
+		},
+		{
+			name: "Invalid health check status",
+			modify: func(cfg *config.Config) {
+				cfg.Domains[0].Routes[0].HealthCheck = &config.HealthCheck{ExpectedStatus: []string{"2xx", "600"}}
+			},
+			expectError: true,
+		},
+		{name: "Unknown initial health", modify: func(cfg *config.Config) { cfg.InitialHealth = "maybe" }, expectError: true},
+		{
+			name: "Conflicting initial health",
+			modify: func(cfg *config.Config) {
+				cfg.InitialHealth = "config"
+				cfg.Domains[0].Routes = append(cfg.Domains[0].Routes, config.Route{
+					Path:     "/web",
+					Backends: []config.Backend{{URL: "http://localhost:8081", Healthy: true}},
+				})
+			},
+			expectError: true,
+		},
+		{
+			name: "gRPC health check",
+			modify: func(cfg *config.Config) {
+				cfg.Domains[0].Routes[0].HealthCheck = &config.HealthCheck{Type: "grpc", Service: "api.Users", UnhealthyThreshold: 2}
+			},
+		},
+		{
+			name: "TCP health check with path",
+			modify: func(cfg *config.Config) {
+				cfg.Domains[0].Routes[0].HealthCheck = &config.HealthCheck{Type: "tcp", Path: "/healthz"}
+			},
+			expectError: true,
+		},
+		{
+			name: "Exec health check without command",
+			modify: func(cfg *config.Config) {
+				cfg.Domains[0].Routes[0].HealthCheck = &config.HealthCheck{Type: "exec"}
+			},
+			expectError: true,
+		},
+		{
+			name: "Unknown health check type",
+			modify: func(cfg *config.Config) {
+				cfg.Domains[0].Routes[0].HealthCheck = &config.HealthCheck{Type: "icmp"}
+			},
+			expectError: true,
+		},
+		{
+			name: "Negative health check threshold",
+			modify: func(cfg *config.Config) {
+				cfg.Domains[0].Routes[0].HealthCheck = &config.HealthCheck{UnhealthyThreshold: -1}
+			},
+			expectError: true,
+		},
+		{
+			name: "Outlier detection without threshold",
+			modify: func(cfg *config.Config) {
+				cfg.Domains[0].Routes[0].OutlierDetection = &config.OutlierDetection{Window: "10s"}
+			},
+			expectError: true,
+		},
+		{
+			name: "Outlier detection percentage above 100",
+			modify: func(cfg *config.Config) {
+				cfg.Domains[0].Routes[0].OutlierDetection = &config.OutlierDetection{FailurePercent: 150}
+			},
+			expectError: true,
+		},
+		{
+			name: "Conflicting health checks",
+			modify: func(cfg *config.Config) {
+				cfg.Domains[0].Routes = append(cfg.Domains[0].Routes, config.Route{
+					Path:        "/web",
+					HealthCheck: &config.HealthCheck{Path: "/healthz"},
+					Backends:    []config.Backend{{URL: "http://localhost:8081"}},
+				})
+			},
+			expectError: true,
+		},
+		{
+			name:        "Negative backend weight",
+			modify:      func(cfg *config.Config) { cfg.Domains[0].Routes[0].Backends[0].Weight = -1 },
+			expectError: true,
+		},
+		{
+			name: "Conflicting backend weights",
+			modify: func(cfg *config.Config) {
+				cfg.Domains[0].Routes = append(cfg.Domains[0].Routes, config.Route{
+					Path:     "/web",
+					Backends: []config.Backend{{URL: "http://localhost:8081", Weight: 2}},
+				})
+			},
+			expectError: true,
+		},
+		{
+			name: "Conflicting backend states",
+			modify: func(cfg *config.Config) {
+				cfg.Domains[0].Routes[0].Backends[0].State = "draining"
+				cfg.Domains[0].Routes = append(cfg.Domains[0].Routes, config.Route{
+					Path:     "/web",
+					Backends: []config.Backend{{URL: "http://localhost:8081"}},
+				})
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Config{
+				Port:                ":8080",
+				HealthCheckInterval: "10s",
+				Domains:             []config.Domain{validDomain()},
+			}
+			tt.modify(&cfg)
+			err := cfg.Validate()
+			if tt.expectError && err == nil {
+				t.Error("Expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseStatusRange(t *testing.T) {
+	tests := []struct {
+		value        string
+		expectedLow  int
+		expectedHigh int
+		expectError  bool
+	}{
+		{value: "200", expectedLow: 200, expectedHigh: 200},
+		{value: "200-399", expectedLow: 200, expectedHigh: 399},
+		{value: "2xx", expectedLow: 200, expectedHigh: 299},
+		{value: "5XX", expectedLow: 500, expectedHigh: 599},
+		{value: "399-200", expectError: true},
+		{value: "6xx", expectError: true},
+		{value: "ok", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			low, high, err := config.ParseStatusRange(tt.value)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if low != tt.expectedLow || high != tt.expectedHigh {
+				t.Errorf("Expected %d-%d, got %d-%d", tt.expectedLow, tt.expectedHigh, low, high)
+			}
+		})
+	}
+}
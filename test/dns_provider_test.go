@@ -0,0 +1,134 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/thetonbr/breezegate/internal/services"
+)
+
+func TestNewDNSProvider(t *testing.T) {
+	tests := []struct {
+		name        string
+		provider    string
+		options     map[string]string
+		expectError bool
+	}{
+		{
+			name:     "RFC2136 with nameserver",
+			provider: services.DNSProviderRFC2136,
+			options: map[string]string{
+				"nameserver":         "127.0.0.1:53",
+				"tsigKey":            "acme.",
+				"tsigSecret":         "c2VjcmV0",
+				"propagationTimeout": "30s",
+				"ttl":                "60",
+			},
+		},
+		{
+			name:        "RFC2136 without nameserver",
+			provider:    services.DNSProviderRFC2136,
+			options:     map[string]string{},
+			expectError: true,
+		},
+		{
+			name:     "Exec with program",
+			provider: services.DNSProviderExec,
+			options:  map[string]string{"program": "/usr/local/bin/dns-hook", "mode": "RAW"},
+		},
+		{
+			name:        "Exec without program",
+			provider:    services.DNSProviderExec,
+			expectError: true,
+		},
+		{
+			name:     "Cloudflare with token",
+			provider: services.DNSProviderCloudflare,
+			options:  map[string]string{"dnsApiToken": "token"},
+		},
+		{
+			name:        "Cloudflare with options but no credentials",
+			provider:    services.DNSProviderCloudflare,
+			options:     map[string]string{"ttl": "120"},
+			expectError: true,
+		},
+		{
+			name:        "Unknown provider",
+			provider:    "carrier-pigeon",
+			expectError: true,
+		},
+		{
+			name:        "Unknown option",
+			provider:    services.DNSProviderRFC2136,
+			options:     map[string]string{"nameserver": "127.0.0.1:53", "nameservr": "typo"},
+			expectError: true,
+		},
+		{
+			name:        "Invalid duration",
+			provider:    services.DNSProviderRFC2136,
+			options:     map[string]string{"nameserver": "127.0.0.1:53", "propagationTimeout": "soon"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, err := services.NewDNSProvider(tt.provider, tt.options)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if provider == nil {
+				t.Error("Expected a provider but got nil")
+			}
+		})
+	}
+}
+
+func TestExecDNSProvider_RunsProgram(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell scripts are not supported on Windows")
+	}
+
+	dir := t.TempDir()
+	output := filepath.Join(dir, "calls.log")
+	script := filepath.Join(dir, "dns-hook.sh")
+	err := os.WriteFile(script, []byte("#!/bin/sh\necho \"$@\" >> "+output+"\n"), 0o700)
+	if err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+
+	provider, err := services.NewDNSProvider(services.DNSProviderExec, map[string]string{"program": script, "mode": "RAW"})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	if err := provider.Present("example.com", "token", "keyauth"); err != nil {
+		t.Fatalf("Present failed: %v", err)
+	}
+	if err := provider.CleanUp("example.com", "token", "keyauth"); err != nil {
+		t.Fatalf("CleanUp failed: %v", err)
+	}
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("Failed to read script output: %v", err)
+	}
+	calls := strings.Split(strings.TrimSpace(string(data)), "\n")
+	expected := []string{"present -- example.com token keyauth", "cleanup -- example.com token keyauth"}
+	if len(calls) != len(expected) {
+		t.Fatalf("Expected %d calls, got %v", len(expected), calls)
+	}
+	for i := range expected {
+		if calls[i] != expected[i] {
+			t.Errorf("Expected call %q, got %q", expected[i], calls[i])
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package test
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/thetonbr/breezegate/internal/config"
+	"github.com/thetonbr/breezegate/internal/gateway"
+)
+
+// freeAddress returns a local address with a port that is not in use.
+func freeAddress(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+// newNamedBackend returns a backend that answers every request with its name.
+func newNamedBackend(t *testing.T, name string) string {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(name))
+	}))
+	t.Cleanup(ts.Close)
+	return ts.URL
+}
+
+// newGatewayTestConfig returns a configuration for example.com with a route for every path, each
+// with one backend.
+func newGatewayTestConfig(port string, routes map[string]string) config.Config {
+	cfg := config.Config{
+		Port:                port,
+		HealthCheckInterval: "1h",
+		ShutdownTimeout:     "1s",
+		Domains:             []config.Domain{{DomainName: "example.com"}},
+	}
+	for path, backend := range routes {
+		cfg.Domains[0].Routes = append(cfg.Domains[0].Routes,
+			config.Route{Path: path, Match: "exact", Backends: []config.Backend{{URL: backend}}})
+	}
+	return cfg
+}
+
+// startGateway applies the configuration to a new gateway and shuts it down when the test ends.
+func startGateway(t *testing.T, cfg config.Config) *gateway.Gateway {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	gw := gateway.New(ctx, cfg)
+	t.Cleanup(func() {
+		if err := gw.Shutdown(); err != nil {
+			t.Errorf("Failed to shut down: %v", err)
+		}
+		cancel()
+	})
+	if err := gw.Apply(cfg); err != nil {
+		t.Fatalf("Failed to apply configuration: %v", err)
+	}
+	return gw
+}
+
+// writeConfigFile writes the configuration as the JSON file a reload reads.
+func writeConfigFile(t *testing.T, file string, cfg config.Config) {
+	t.Helper()
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("Failed to marshal configuration: %v", err)
+	}
+	if err := os.WriteFile(file, data, 0o600); err != nil {
+		t.Fatalf("Failed to write configuration: %v", err)
+	}
+}
+
+// gatewayGet sends a request for example.com to the gateway and returns the response body, or the
+// status if it is not 200.
+func gatewayGet(t *testing.T, address, path string) string {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, "http://"+address+path, http.NoBody)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Host = "example.com"
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request to %s failed: %v", path, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp.Status
+	}
+	return string(body)
+}
+
+func TestGateway_ReloadChangesRoutes(t *testing.T) {
+	backendA, backendB, backendC := newNamedBackend(t, "A"), newNamedBackend(t, "B"), newNamedBackend(t, "C")
+	address := freeAddress(t)
+	gw := startGateway(t, newGatewayTestConfig(address, map[string]string{"/a": backendA, "/b": backendB}))
+
+	file := filepath.Join(t.TempDir(), "config.json")
+	writeConfigFile(t, file, newGatewayTestConfig(address, map[string]string{"/a": backendC, "/c": backendA}))
+	if err := gw.Reload(file); err != nil {
+		t.Fatalf("Failed to reload: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		expected string
+	}{
+		{name: "Changed Backend", path: "/a", expected: "C"},
+		{name: "Removed Route", path: "/b", expected: "503 Service Unavailable"},
+		{name: "Added Route", path: "/c", expected: "A"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := gatewayGet(t, address, tt.path); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+	if routes := gw.Config().Domains[0].Routes; len(routes) != 2 {
+		t.Errorf("Expected 2 running routes, got %d", len(routes))
+	}
+}
+
+func TestGateway_ReloadRejectsInvalidFile(t *testing.T) {
+	backendA := newNamedBackend(t, "A")
+	address := freeAddress(t)
+	gw := startGateway(t, newGatewayTestConfig(address, map[string]string{"/a": backendA}))
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "Malformed JSON", content: `{"port": `},
+		{name: "Invalid Configuration", content: `{"port": "` + address + `", "healthCheckInterval": "soon"}`},
+		{name: "Missing File"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "config.json")
+			if tt.content != "" {
+				if err := os.WriteFile(file, []byte(tt.content), 0o600); err != nil {
+					t.Fatalf("Failed to write configuration: %v", err)
+				}
+			}
+			if err := gw.Reload(file); err == nil {
+				t.Error("Expected the reload to fail, got nil")
+			}
+			if got := gatewayGet(t, address, "/a"); got != "A" {
+				t.Errorf("Expected the running configuration to keep serving A, got %q", got)
+			}
+		})
+	}
+}
+
+func TestGateway_ReloadReusesUnchangedTLSDomains(t *testing.T) {
+	backend := newNamedBackend(t, "A")
+	dir := t.TempDir()
+	certFile, keyFile := writeCertificateFiles(t, dir, newTestCertificate(t, time.Hour, "example.com"))
+	cfg := newGatewayTestConfig(freeAddress(t), map[string]string{"/a": backend})
+	cfg.HTTPSPort = freeAddress(t)
+	cfg.Domains[0].UseTLS = true
+	cfg.Domains[0].CertFile = certFile
+	cfg.Domains[0].KeyFile = keyFile
+	gw := startGateway(t, cfg)
+	first := servedCertificate(t, cfg.HTTPSPort)
+
+	// The certificate files are watched far less often than this test runs, so only a restarted
+	// domain loads the new certificate
+	writeCertificateFiles(t, dir, newTestCertificate(t, time.Hour, "example.com"))
+	file := filepath.Join(dir, "config.json")
+
+	tests := []struct {
+		name      string
+		change    func(cfg *config.Config)
+		restarted bool
+	}{
+		{
+			name: "Routes Changed",
+			change: func(cfg *config.Config) {
+				cfg.Domains[0].Routes = append(cfg.Domains[0].Routes,
+					config.Route{Path: "/b", Backends: []config.Backend{{URL: backend}}})
+			},
+		},
+		{
+			name:      "Certificate Settings Changed",
+			change:    func(cfg *config.Config) { cfg.Domains[0].Aliases = []string{"www.example.com"} },
+			restarted: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.change(&cfg)
+			writeConfigFile(t, file, cfg)
+			if err := gw.Reload(file); err != nil {
+				t.Fatalf("Failed to reload: %v", err)
+			}
+			if restarted := servedCertificate(t, cfg.HTTPSPort) != first; restarted != tt.restarted {
+				t.Errorf("Expected restarted %v, got %v", tt.restarted, restarted)
+			}
+		})
+	}
+}
+
+func TestGateway_Update(t *testing.T) {
+	backendA, backendB := newNamedBackend(t, "A"), newNamedBackend(t, "B")
+	address := freeAddress(t)
+	gw := startGateway(t, newGatewayTestConfig(address, map[string]string{"/a": backendA}))
+
+	tests := []struct {
+		name        string
+		edit        func(cfg *config.Config) error
+		expectError bool
+		expected    string
+	}{
+		{
+			name: "Failed Edit",
+			edit: func(cfg *config.Config) error {
+				cfg.Domains[0].Routes[0].Backends[0].URL = backendB
+				return errors.New("rejected")
+			},
+			expectError: true,
+			expected:    "A",
+		},
+		{
+			name: "Edit",
+			edit: func(cfg *config.Config) error {
+				cfg.Domains[0].Routes[0].Backends[0].URL = backendB
+				return nil
+			},
+			expected: "B",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := gw.Update(tt.edit)
+			if tt.expectError && err == nil {
+				t.Error("Expected the update to fail, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected the update to succeed, got %v", err)
+			}
+			if got := gatewayGet(t, address, "/a"); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// servedCertificate returns the serial number of the certificate served for example.com.
+func servedCertificate(t *testing.T, address string) string {
+	t.Helper()
+	conn, err := tls.Dial("tcp", address, &tls.Config{
+		ServerName:         "example.com",
+		InsecureSkipVerify: true, //nolint:gosec // the test certificates are self-signed
+	})
+	if err != nil {
+		t.Fatalf("TLS handshake failed: %v", err)
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].SerialNumber.String()
+}
@@ -0,0 +1,313 @@
+package test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/thetonbr/breezegate/internal/domain"
+	"github.com/thetonbr/breezegate/internal/services"
+)
+
+func TestHTTPProber(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/healthz" && r.Method == http.MethodGet:
+			_, _ = w.Write([]byte(`{"status":"ok","version":"1.2.3"}`))
+		case r.URL.Path == "/vhost" && r.Host == "internal.example.com" && r.Header.Get("X-Probe") == "1":
+			w.WriteHeader(http.StatusNoContent)
+		case r.URL.Path == "/moved":
+			http.Redirect(w, r, "/healthz", http.StatusFound)
+		case r.URL.Path == "/slow":
+			time.Sleep(200 * time.Millisecond)
+		case r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name        string
+		opts        services.HealthCheckOptions
+		timeout     time.Duration
+		expectError bool
+	}{
+		{name: "Default HEAD Rejected", opts: services.HealthCheckOptions{}, expectError: true},
+		{
+			name: "Expected Status Range",
+			opts: services.HealthCheckOptions{ExpectedStatus: []services.StatusRange{{Min: 200, Max: 499}}},
+		},
+		{name: "Path With GET", opts: services.HealthCheckOptions{Path: "/healthz", Method: http.MethodGet}},
+		{name: "Body Contains", opts: services.HealthCheckOptions{Path: "/healthz", BodyContains: `"status":"ok"`}},
+		{
+			name:        "Body Contains Missing",
+			opts:        services.HealthCheckOptions{Path: "/healthz", BodyContains: "degraded"},
+			expectError: true,
+		},
+		{name: "Body Regex", opts: services.HealthCheckOptions{Path: "/healthz", BodyRegex: `"version":"1\.\d+`}},
+		{
+			name:        "Body Regex Mismatch",
+			opts:        services.HealthCheckOptions{Path: "/healthz", BodyRegex: `"version":"2\.`},
+			expectError: true,
+		},
+		{
+			name: "Redirect Expected",
+			opts: services.HealthCheckOptions{
+				Path:           "/moved",
+				Method:         http.MethodGet,
+				ExpectedStatus: []services.StatusRange{{Min: 300, Max: 399}},
+			},
+		},
+		{
+			name:        "Redirect Not Followed",
+			opts:        services.HealthCheckOptions{Path: "/moved", Method: http.MethodGet},
+			expectError: true,
+		},
+		{
+			name: "Host And Headers",
+			opts: services.HealthCheckOptions{
+				Path:           "/vhost",
+				Host:           "internal.example.com",
+				Headers:        map[string]string{"X-Probe": "1"},
+				ExpectedStatus: []services.StatusRange{{Min: 204, Max: 204}},
+			},
+		},
+		{
+			name:        "Timeout",
+			opts:        services.HealthCheckOptions{Path: "/slow", Method: http.MethodGet},
+			timeout:     50 * time.Millisecond,
+			expectError: true,
+		},
+	}
+
+	server := &domain.Server{URL: parseURL(ts.URL)}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prober, err := services.NewHTTPProber(tt.opts)
+			if err != nil {
+				t.Fatalf("Failed to create prober: %v", err)
+			}
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			err = prober.Probe(ctx, server)
+			if tt.expectError && err == nil {
+				t.Error("Expected the probe to fail, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected the probe to pass, got %v", err)
+			}
+		})
+	}
+}
+
+func TestBackendPool_RestartsChangedHealthChecks(t *testing.T) {
+	paths := make(chan string, 100)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case paths <- r.URL.Path:
+		default:
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pool := services.NewBackendPool(ctx, time.Hour)
+	opts := services.HealthCheckOptions{Path: "/first", Interval: 10 * time.Millisecond}
+	first, err := pool.Prepare(ts.URL, false)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	pool.SetHealthChecks(map[string]services.HealthCheckOptions{ts.URL: opts})
+	waitForPath(t, paths, "/first")
+
+	opts.Path = "/second"
+	second, err := pool.Prepare(ts.URL, false)
+	if err != nil {
+		t.Fatalf("Failed to get server: %v", err)
+	}
+	pool.SetHealthChecks(map[string]services.HealthCheckOptions{ts.URL: opts})
+	if first != second {
+		t.Error("Expected a changed health check to keep the server")
+	}
+	waitForPath(t, paths, "/second")
+}
+
+func waitForPath(t *testing.T, paths <-chan string, expected string) {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case path := <-paths:
+			if path == expected {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Expected a health check request to %s", expected)
+		}
+	}
+}
+
+func TestNewProber(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        services.HealthCheckOptions
+		expectError bool
+	}{
+		{name: "Default", opts: services.HealthCheckOptions{}},
+		{name: "TCP", opts: services.HealthCheckOptions{Type: services.ProbeTCP}},
+		{name: "gRPC", opts: services.HealthCheckOptions{Type: services.ProbeGRPC, Service: "api.Users"}},
+		{name: "Exec", opts: services.HealthCheckOptions{Type: services.ProbeExec, Command: []string{"true"}}},
+		{name: "Exec Without Command", opts: services.HealthCheckOptions{Type: services.ProbeExec}, expectError: true},
+		{name: "Unknown", opts: services.HealthCheckOptions{Type: "udp"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := services.NewProber(tt.opts)
+			if tt.expectError && err == nil {
+				t.Error("Expected an error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestTCPProber(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	open := "http://" + listener.Addr().String()
+	closedListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	closed := "http://" + closedListener.Addr().String()
+	_ = closedListener.Close()
+
+	prober, err := services.NewProber(services.HealthCheckOptions{Type: services.ProbeTCP})
+	if err != nil {
+		t.Fatalf("Failed to create prober: %v", err)
+	}
+	if err := prober.Probe(context.Background(), &domain.Server{URL: parseURL(open)}); err != nil {
+		t.Errorf("Expected a listening backend to pass, got %v", err)
+	}
+	if err := prober.Probe(context.Background(), &domain.Server{URL: parseURL(closed)}); err == nil {
+		t.Error("Expected a closed port to fail, got nil")
+	}
+}
+
+func TestExecProber(t *testing.T) {
+	tests := []struct {
+		name          string
+		command       []string
+		expectedError string
+	}{
+		{name: "Exit Zero", command: []string{"sh", "-c", `test "$BREEZEGATE_BACKEND_PORT" = 8080`}},
+		{name: "Backend Environment", command: []string{"sh", "-c", `test "$BREEZEGATE_BACKEND_URL" = http://backend1:8080`}},
+		{name: "Exit Nonzero", command: []string{"sh", "-c", "echo replication lag; exit 2"}, expectedError: "replication lag"},
+	}
+
+	server := &domain.Server{URL: parseURL("http://backend1:8080")}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prober, err := services.NewProber(services.HealthCheckOptions{Type: services.ProbeExec, Command: tt.command})
+			if err != nil {
+				t.Fatalf("Failed to create prober: %v", err)
+			}
+			err = prober.Probe(context.Background(), server)
+			if tt.expectedError == "" {
+				if err != nil {
+					t.Errorf("Expected the probe to pass, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+				t.Errorf("Expected an error containing %q, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
+
+// newFakeGRPCHealthServer answers grpc.health.v1 calls over cleartext HTTP/2 with the given serving
+// status, or with grpc-status UNIMPLEMENTED and no message if status is negative. The path, content
+// type and body of every call are sent to requests.
+func newFakeGRPCHealthServer(t *testing.T, status int, requests chan<- string) string {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- r.URL.Path + " " + r.Header.Get("Content-Type") + " " + string(body)
+
+		w.Header().Set("Content-Type", "application/grpc")
+		if status < 0 {
+			w.Header().Set("Grpc-Status", "12")
+			return
+		}
+		w.Header().Set("Trailer", "Grpc-Status")
+		_, _ = w.Write([]byte{0, 0, 0, 0, 2, 0x08, byte(status)})
+		w.Header().Set("Grpc-Status", "0")
+	})
+	ts := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	t.Cleanup(ts.Close)
+	return ts.URL
+}
+
+func TestGRPCProber(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		expectError bool
+	}{
+		{name: "Serving", status: 1},
+		{name: "Not Serving", status: 2, expectError: true},
+		{name: "Unknown Service", status: 3, expectError: true},
+		{name: "Health Service Missing", status: -1, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := make(chan string, 1)
+			backend := newFakeGRPCHealthServer(t, tt.status, requests)
+			prober, err := services.NewProber(services.HealthCheckOptions{Type: services.ProbeGRPC, Service: "api.Users"})
+			if err != nil {
+				t.Fatalf("Failed to create prober: %v", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			err = prober.Probe(ctx, &domain.Server{URL: parseURL(backend)})
+			if tt.expectError && err == nil {
+				t.Error("Expected the probe to fail, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected the probe to pass, got %v", err)
+			}
+
+			request := <-requests
+			for _, expected := range []string{"/grpc.health.v1.Health/Check", "application/grpc", "api.Users"} {
+				if !strings.Contains(request, expected) {
+					t.Errorf("Expected the call to contain %q, got %q", expected, request)
+				}
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package test
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -47,8 +48,11 @@ func TestHealthCheck(t *testing.T) {
 				IsHealthy: false, // initially unhealthy
 			}
 
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
 			// Ensure that services.HealthCheck is being called correctly
-			go services.HealthCheck(server, 1*time.Second)
+			go services.HealthCheck(ctx, server, 1*time.Second)
 			time.Sleep(2 * time.Second) // Give time for health check
 
 			if server.GetHealthStatus() != tt.expectedHealthy {
@@ -65,3 +69,151 @@ func parseURL(rawURL string) *url.URL {
 	}
 	return parsed
 }
+
+func TestHealthCheck_StopsWhenCanceled(t *testing.T) {
+	requests := make(chan struct{}, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		select {
+		case requests <- struct{}{}:
+		default:
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	server := &domain.Server{URL: parseURL(ts.URL)}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		services.HealthCheck(ctx, server, 10*time.Millisecond)
+		close(done)
+	}()
+
+	<-requests
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected health check to stop after its context was canceled")
+	}
+}
+
+// newGatedServer returns a backend that answers every probe with status, but only after the test
+// received its arrival and released it, so the test can inspect the server between probes.
+func newGatedServer(status int) (ts *httptest.Server, arrived, release chan struct{}) {
+	arrived = make(chan struct{})
+	release = make(chan struct{})
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case arrived <- struct{}{}:
+		case <-r.Context().Done():
+			return
+		}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	return ts, arrived, release
+}
+
+func TestHealthCheck_Thresholds(t *testing.T) {
+	tests := []struct {
+		name            string
+		status          int
+		initialHealthy  bool
+		opts            services.HealthCheckOptions
+		expectedHealthy []bool
+	}{
+		{
+			name:            "Unhealthy After Consecutive Failures",
+			status:          http.StatusServiceUnavailable,
+			initialHealthy:  true,
+			opts:            services.HealthCheckOptions{UnhealthyThreshold: 3},
+			expectedHealthy: []bool{true, true, true, false},
+		},
+		{
+			name:            "Healthy After Consecutive Passes",
+			status:          http.StatusOK,
+			initialHealthy:  false,
+			opts:            services.HealthCheckOptions{HealthyThreshold: 2},
+			expectedHealthy: []bool{false, false, true},
+		},
+		{
+			name:            "Default Thresholds",
+			status:          http.StatusServiceUnavailable,
+			initialHealthy:  true,
+			expectedHealthy: []bool{true, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, arrived, release := newGatedServer(tt.status)
+			defer ts.Close()
+			server := &domain.Server{URL: parseURL(ts.URL), IsHealthy: tt.initialHealthy}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			tt.opts.Interval = 10 * time.Millisecond
+			go services.HealthCheckWithOptions(ctx, server, tt.opts)
+
+			// Before each probe, the server reflects the results of all earlier probes
+			for i, expected := range tt.expectedHealthy {
+				<-arrived
+				if server.GetHealthStatus() != expected {
+					t.Errorf("Expected health %v before probe %d, got %v", expected, i+1, server.GetHealthStatus())
+				}
+				release <- struct{}{}
+			}
+		})
+	}
+}
+
+func TestHealthCheck_BacksOffWhileUnhealthy(t *testing.T) {
+	ts, arrived, release := newGatedServer(http.StatusServiceUnavailable)
+	defer ts.Close()
+	server := &domain.Server{URL: parseURL(ts.URL), IsHealthy: true}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	opts := services.HealthCheckOptions{Interval: 10 * time.Millisecond, MaxBackoff: 40 * time.Millisecond}
+	go services.HealthCheckWithOptions(ctx, server, opts)
+
+	// The gaps after each failure are at least 10ms, 20ms, 40ms and then capped at 40ms
+	minimumGaps := []time.Duration{10, 20, 40, 40}
+	<-arrived
+	release <- struct{}{}
+	last := time.Now()
+	for i, gap := range minimumGaps {
+		<-arrived
+		elapsed := time.Since(last)
+		if elapsed < gap*time.Millisecond {
+			t.Errorf("Expected probe %d at least %dms after the previous one, got %v", i+2, gap, elapsed)
+		}
+		release <- struct{}{}
+		last = time.Now()
+	}
+}
+
+func TestHealthCheck_ProbesImmediately(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	server := &domain.Server{URL: parseURL(ts.URL), IsHealthy: false}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go services.HealthCheck(ctx, server, time.Hour)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !server.GetHealthStatus() {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the first health check to run without waiting for the interval")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
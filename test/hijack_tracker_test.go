@@ -0,0 +1,81 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/thetonbr/breezegate/internal/handlers"
+)
+
+// dialHijacked opens a connection to the server and sends a request that the server hijacks.
+func dialHijacked(t *testing.T, ts *httptest.Server, tracker *handlers.HijackTracker) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	if _, err := conn.Write([]byte("GET /ws HTTP/1.1\r\nHost: example.com\r\n\r\n")); err != nil {
+		t.Fatalf("Failed to write request: %v", err)
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || line != "HTTP/1.1 101 Switching Protocols\r\n" {
+		t.Fatalf("Expected protocol switch, got %q (%v)", line, err)
+	}
+	if tracker.Len() != 1 {
+		t.Fatalf("Expected 1 tracked connection, got %d", tracker.Len())
+	}
+	return conn
+}
+
+func TestHijackTracker_Drain(t *testing.T) {
+	tracker := handlers.NewHijackTracker()
+	ts := httptest.NewServer(tracker.Wrap(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		conn, rw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Errorf("Failed to hijack: %v", err)
+			return
+		}
+		_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n\r\n")
+		_ = rw.Flush()
+		// Echo until either side closes the connection
+		_, _ = io.Copy(conn, rw)
+		_ = conn.Close()
+	})))
+	defer ts.Close()
+
+	t.Run("Waits for connections to close", func(t *testing.T) {
+		conn := dialHijacked(t, ts, tracker)
+		time.AfterFunc(50*time.Millisecond, func() { _ = conn.Close() })
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if err := tracker.Drain(ctx); err != nil {
+			t.Errorf("Expected drain to complete, got %v", err)
+		}
+	})
+
+	t.Run("Closes connections after the timeout", func(t *testing.T) {
+		conn := dialHijacked(t, ts, tracker)
+		defer conn.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if err := tracker.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected deadline exceeded, got %v", err)
+		}
+		if tracker.Len() != 0 {
+			t.Errorf("Expected remaining connections to be closed, got %d", tracker.Len())
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+			t.Errorf("Expected server to close the connection, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/thetonbr/breezegate/internal/handlers"
+	"github.com/thetonbr/breezegate/internal/services"
+)
+
+func TestHTTPSRedirectHandler(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("proxied"))
+	})
+	hosts := []string{"example.com", "*.example.org"}
+
+	tests := []struct {
+		name             string
+		httpsAddr        string
+		status           int
+		url              string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{
+			name:             "Keeps path and query",
+			httpsAddr:        ":443",
+			status:           http.StatusMovedPermanently,
+			url:              "http://example.com/api/users?page=2&q=a%20b",
+			expectedStatus:   http.StatusMovedPermanently,
+			expectedLocation: "https://example.com/api/users?page=2&q=a%20b",
+		},
+		{
+			name:             "Non-default HTTPS port",
+			httpsAddr:        ":8443",
+			status:           http.StatusPermanentRedirect,
+			url:              "http://example.com:8080/",
+			expectedStatus:   http.StatusPermanentRedirect,
+			expectedLocation: "https://example.com:8443/",
+		},
+		{
+			name:             "Wildcard host",
+			httpsAddr:        ":443",
+			status:           http.StatusPermanentRedirect,
+			url:              "http://shop.example.org/cart",
+			expectedStatus:   http.StatusPermanentRedirect,
+			expectedLocation: "https://shop.example.org/cart",
+		},
+		{
+			name:           "Plain HTTP host",
+			httpsAddr:      ":443",
+			status:         http.StatusMovedPermanently,
+			url:            "http://other.com/api",
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := handlers.NewHTTPSRedirectHandler(hosts, tt.httpsAddr, tt.status, next)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.url, http.NoBody))
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if location := w.Header().Get("Location"); location != tt.expectedLocation {
+				t.Errorf("Expected location %q, got %q", tt.expectedLocation, location)
+			}
+		})
+	}
+}
+
+func TestHTTPSRedirectHandler_ExemptsACMEChallenges(t *testing.T) {
+	provider := services.NewHTTPChallengeProvider()
+	if err := provider.Present("example.com", "token", "token.thumbprint"); err != nil {
+		t.Fatalf("Failed to present challenge: %v", err)
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	redirect := handlers.NewHTTPSRedirectHandler([]string{"example.com"}, ":443", http.StatusMovedPermanently, next)
+	handler := handlers.NewACMEChallengeHandler(provider, redirect)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com/.well-known/acme-challenge/token", http.NoBody))
+	if w.Code != http.StatusOK || w.Body.String() != "token.thumbprint" {
+		t.Errorf("Expected challenge to be answered over HTTP, got %d %q", w.Code, w.Body.String())
+	}
+}
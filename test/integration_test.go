@@ -81,3 +81,24 @@ func mustParseURL(rawURL string) *url.URL {
 	}
 	return parsed
 }
+
+func TestLoadBalancerHandler_SetsAffinityCookie(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer backend.Close()
+
+	lb := domain.NewLoadBalancer()
+	opts := domain.RouteOptions{Affinity: domain.NewAffinity(domain.AffinityCookie{Name: "route"}, []byte("secret"))}
+	err := lb.AddHostRouteWithOptions("", "/", domain.MatchPrefix, opts, []*domain.Server{
+		{URL: mustParseURL(backend.URL), IsHealthy: true},
+	})
+	if err != nil {
+		t.Fatalf("Failed to add route: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	handlers.NewLoadBalancerHandler(lb).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "route" {
+		t.Errorf("Expected the affinity cookie to be set, got %v", cookies)
+	}
+}
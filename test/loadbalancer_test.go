@@ -18,6 +18,12 @@ func newTestServer(host string, healthy bool) *domain.Server {
 	}
 }
 
+func newDrainingServer(host string) *domain.Server {
+	server := newTestServer(host, true)
+	server.SetAdminState(domain.StateDraining, 0)
+	return server
+}
+
 func TestLoadBalancer_AddRoute(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -75,6 +81,13 @@ func TestLoadBalancer_GetBackendForPath(t *testing.T) {
 			expectedHealthy: true,
 			expectedURL:     "http://localhost:8081",
 		},
+		{
+			name:            "Draining Server Skipped",
+			route:           "/api",
+			servers:         []*domain.Server{newDrainingServer("http://localhost:8080"), newTestServer("http://localhost:8081", true)},
+			expectedHealthy: true,
+			expectedURL:     "http://localhost:8081",
+		},
 		{
 			name:            "All Unhealthy",
 			route:           "/api",
@@ -102,3 +115,76 @@ func TestLoadBalancer_GetBackendForPath(t *testing.T) {
 		})
 	}
 }
+
+func newWeightedServer(host string, weight int) *domain.Server {
+	server := newTestServer(host, true)
+	server.SetWeight(weight)
+	return server
+}
+
+func TestLoadBalancer_WeightedRoundRobin(t *testing.T) {
+	tests := []struct {
+		name     string
+		weights  []int
+		expected string
+	}{
+		{name: "Equal Weights", weights: []int{1, 1, 1}, expected: "abcabc"},
+		{name: "Default Weights", weights: []int{0, 0}, expected: "abab"},
+		{name: "Smooth Distribution", weights: []int{5, 1, 1}, expected: "aabacaa"},
+		{name: "Two To One", weights: []int{2, 1}, expected: "abaaba"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var servers []*domain.Server
+			for i, weight := range tt.weights {
+				servers = append(servers, newWeightedServer("http://"+string(rune('a'+i)), weight))
+			}
+			lb := domain.NewLoadBalancer()
+			lb.AddRoute("/", servers)
+
+			var got string
+			for range tt.expected {
+				got += lb.GetBackendForPath("/").URL.Host
+			}
+			if got != tt.expected {
+				t.Errorf("Expected sequence %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestLoadBalancer_WeightChangeKeepsRotation(t *testing.T) {
+	a, b := newWeightedServer("http://a", 1), newWeightedServer("http://b", 1)
+	lb := domain.NewLoadBalancer()
+	lb.AddRoute("/", []*domain.Server{a, b})
+
+	if got := lb.GetBackendForPath("/"); got != a {
+		t.Fatalf("Expected a first, got %s", got.URL)
+	}
+	b.SetWeight(3)
+	var got string
+	for range 5 {
+		got += lb.GetBackendForPath("/").URL.Host
+	}
+	if got != "bbabb" {
+		t.Errorf("Expected sequence bbabb after the weight change, got %s", got)
+	}
+}
+
+func TestLoadBalancer_ReplaceKeepsRotation(t *testing.T) {
+	a, b := newWeightedServer("http://a", 1), newWeightedServer("http://b", 1)
+	lb := domain.NewLoadBalancer()
+	lb.AddRoute("/", []*domain.Server{a, b})
+	if got := lb.GetBackendForPath("/"); got != a {
+		t.Fatalf("Expected a first, got %s", got.URL)
+	}
+
+	// Replacing the routes continues the rotation instead of starting over with a
+	next := domain.NewLoadBalancer()
+	next.AddRoute("/", []*domain.Server{a, b})
+	lb.Replace(next)
+	if got := lb.GetBackendForPath("/"); got != b {
+		t.Errorf("Expected b after replace, got %s", got.URL)
+	}
+}
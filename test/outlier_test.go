@@ -0,0 +1,232 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/thetonbr/breezegate/internal/domain"
+	"github.com/thetonbr/breezegate/internal/handlers"
+)
+
+func newOutlierLoadBalancer(t *testing.T, detection domain.OutlierDetection, backends []*domain.Server) *domain.LoadBalancer {
+	lb := domain.NewLoadBalancer()
+	opts := domain.RouteOptions{OutlierDetection: &detection}
+	if err := lb.AddHostRouteWithOptions("", "/", domain.MatchPrefix, opts, backends); err != nil {
+		t.Fatalf("Failed to add route: %v", err)
+	}
+	return lb
+}
+
+func TestOutlierDetection_Ejects(t *testing.T) {
+	tests := []struct {
+		name            string
+		detection       domain.OutlierDetection
+		outcomes        []bool
+		expectedEjected bool
+	}{
+		{
+			name:            "Consecutive Failures",
+			detection:       domain.OutlierDetection{ConsecutiveFailures: 3},
+			outcomes:        []bool{true, true, true},
+			expectedEjected: true,
+		},
+		{
+			name:            "Success Resets Consecutive Failures",
+			detection:       domain.OutlierDetection{ConsecutiveFailures: 3},
+			outcomes:        []bool{true, true, false, true, true},
+			expectedEjected: false,
+		},
+		{
+			name:            "Failure Rate",
+			detection:       domain.OutlierDetection{FailurePercent: 50, MinRequests: 4},
+			outcomes:        []bool{false, true, false, true},
+			expectedEjected: true,
+		},
+		{
+			name:            "Failure Rate Below Minimum Requests",
+			detection:       domain.OutlierDetection{FailurePercent: 50, MinRequests: 4},
+			outcomes:        []bool{true, true, true},
+			expectedEjected: false,
+		},
+		{
+			name:            "Failure Rate Below Threshold",
+			detection:       domain.OutlierDetection{FailurePercent: 50, MinRequests: 4},
+			outcomes:        []bool{false, false, false, true},
+			expectedEjected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer("http://backend1:8080", true)
+			backends := []*domain.Server{server, newTestServer("http://backend2:8080", true)}
+			lb := newOutlierLoadBalancer(t, tt.detection, backends)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for _, failed := range tt.outcomes {
+				lb.RecordOutcome(req, server, failed)
+			}
+			if server.IsEjected() != tt.expectedEjected {
+				t.Errorf("Expected ejected %v, got %v", tt.expectedEjected, server.IsEjected())
+			}
+			routed := false
+			for range 4 {
+				routed = routed || lb.GetBackendForPath("/") == server
+			}
+			if routed == tt.expectedEjected {
+				t.Errorf("Expected routed %v, got %v", !tt.expectedEjected, routed)
+			}
+		})
+	}
+}
+
+func TestOutlierDetection_MaxEjectionPercent(t *testing.T) {
+	tests := []struct {
+		name               string
+		backends           int
+		maxEjectionPercent int
+		unhealthy          int
+		expectedEjected    int
+	}{
+		{name: "Single Backend", backends: 1, maxEjectionPercent: 50, expectedEjected: 0},
+		{name: "Three Backends", backends: 3, maxEjectionPercent: 50, expectedEjected: 1},
+		{name: "Four Backends", backends: 4, maxEjectionPercent: 50, expectedEjected: 2},
+		{name: "All Backends Keeps One", backends: 3, maxEjectionPercent: 100, expectedEjected: 2},
+		{name: "Last Healthy Backend Kept", backends: 3, maxEjectionPercent: 100, unhealthy: 2, expectedEjected: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backends := newRingBackends(tt.backends)
+			for _, server := range backends[len(backends)-tt.unhealthy:] {
+				server.SetHealthStatus(false)
+			}
+			detection := domain.OutlierDetection{ConsecutiveFailures: 1, MaxEjectionPercent: tt.maxEjectionPercent}
+			lb := newOutlierLoadBalancer(t, detection, backends)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for _, server := range backends {
+				lb.RecordOutcome(req, server, true)
+			}
+
+			ejected := 0
+			for _, server := range backends {
+				if server.IsEjected() {
+					ejected++
+				}
+			}
+			if ejected != tt.expectedEjected {
+				t.Errorf("Expected %d ejected backends, got %d", tt.expectedEjected, ejected)
+			}
+			for range 10 {
+				if server := lb.GetBackendForPath("/"); server == nil || server.IsEjected() {
+					t.Fatalf("Expected a backend that is not ejected, got %v", server)
+				}
+			}
+		})
+	}
+}
+
+func TestOutlierDetection_EjectsFromFailingRouteOnly(t *testing.T) {
+	shared := newTestServer("http://backend1:8080", true)
+	other := newTestServer("http://backend2:8080", true)
+	detection := domain.OutlierDetection{ConsecutiveFailures: 1}
+	lb := domain.NewLoadBalancer()
+	routes := []struct {
+		path     string
+		backends []*domain.Server
+	}{
+		{path: "/a", backends: []*domain.Server{shared, other}},
+		{path: "/b", backends: []*domain.Server{shared}},
+	}
+	for _, route := range routes {
+		opts := domain.RouteOptions{OutlierDetection: &detection}
+		if err := lb.AddHostRouteWithOptions("", route.path, domain.MatchPrefix, opts, route.backends); err != nil {
+			t.Fatalf("Failed to add route: %v", err)
+		}
+	}
+
+	if !lb.RecordOutcome(httptest.NewRequest(http.MethodGet, "/a", nil), shared, true) {
+		t.Fatal("Expected the failure on /a to eject the backend")
+	}
+	for range 4 {
+		if server := lb.GetBackendForPath("/a"); server != other {
+			t.Errorf("Expected /a to use backend2, got %v", server)
+		}
+	}
+	if server := lb.GetBackendForPath("/b"); server != shared {
+		t.Errorf("Expected /b to keep using backend1, got %v", server)
+	}
+}
+
+func TestOutlierDetection_KeepsEjectionsAcrossReplace(t *testing.T) {
+	server := newTestServer("http://backend1:8080", true)
+	backends := []*domain.Server{server, newTestServer("http://backend2:8080", true)}
+	detection := domain.OutlierDetection{ConsecutiveFailures: 1}
+	lb := newOutlierLoadBalancer(t, detection, backends)
+
+	if !lb.RecordOutcome(httptest.NewRequest(http.MethodGet, "/", nil), server, true) {
+		t.Fatal("Expected the failure to eject the backend")
+	}
+	lb.Replace(newOutlierLoadBalancer(t, detection, backends))
+	for range 4 {
+		if lb.GetBackendForPath("/") == server {
+			t.Fatal("Expected the ejected backend to stay ejected after the routes were replaced")
+		}
+	}
+}
+
+func TestOutlierDetection_EjectionTimeGrows(t *testing.T) {
+	server := newTestServer("http://backend1:8080", true)
+	backends := []*domain.Server{server, newTestServer("http://backend2:8080", true)}
+	detection := domain.OutlierDetection{ConsecutiveFailures: 1, BaseEjectionTime: 100 * time.Millisecond}
+	lb := newOutlierLoadBalancer(t, detection, backends)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	if !lb.RecordOutcome(req, server, true) {
+		t.Fatal("Expected the first failure to eject the backend")
+	}
+	time.Sleep(120 * time.Millisecond)
+	if server.IsEjected() {
+		t.Fatal("Expected the backend to be readmitted after the base ejection time")
+	}
+
+	if !lb.RecordOutcome(req, server, true) {
+		t.Fatal("Expected the failure after readmission to eject the backend again")
+	}
+	time.Sleep(120 * time.Millisecond)
+	if !server.IsEjected() {
+		t.Error("Expected the second ejection to last twice the base ejection time")
+	}
+}
+
+func TestLoadBalancerHandler_EjectsFailingBackends(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer working.Close()
+
+	failingServer := newTestServer(failing.URL, true)
+	backends := []*domain.Server{failingServer, newTestServer(working.URL, true)}
+	lb := newOutlierLoadBalancer(t, domain.OutlierDetection{ConsecutiveFailures: 1}, backends)
+	handler := handlers.NewLoadBalancerHandler(lb)
+
+	statuses := make(map[int]int)
+	for range 6 {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		statuses[rec.Code]++
+	}
+	if !failingServer.IsEjected() {
+		t.Error("Expected the backend answering 500 to be ejected")
+	}
+	if statuses[http.StatusInternalServerError] != 1 || statuses[http.StatusOK] != 5 {
+		t.Errorf("Expected 1 failed and 5 successful requests, got %v", statuses)
+	}
+}
@@ -0,0 +1,162 @@
+package test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/thetonbr/breezegate/internal/domain"
+)
+
+func newRingHashBalancer(t *testing.T, key domain.HashKey) domain.Balancer {
+	balancer, err := domain.NewBalancer(domain.AlgorithmRingHash, domain.BalancerOptions{HashKey: key})
+	if err != nil {
+		t.Fatalf("Failed to create balancer: %v", err)
+	}
+	return balancer
+}
+
+func newRingBackends(n int) []*domain.Server {
+	var backends []*domain.Server
+	for i := range n {
+		backends = append(backends, newTestServer(fmt.Sprintf("http://backend%d:8080", i), true))
+	}
+	return backends
+}
+
+func requestWithUser(user string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-User", user)
+	return req
+}
+
+func TestParseHashKey(t *testing.T) {
+	tests := []struct {
+		name        string
+		source      string
+		keyName     string
+		expected    domain.HashKey
+		expectError bool
+	}{
+		{name: "Default", expected: domain.HashKey{Source: domain.HashSourceIP}},
+		{name: "IP Ignores Name", source: "ip", keyName: "X", expected: domain.HashKey{Source: domain.HashSourceIP}},
+		{
+			name:     "Header",
+			source:   "header",
+			keyName:  "X-User",
+			expected: domain.HashKey{Source: domain.HashSourceHeader, Name: "X-User"},
+		},
+		{name: "Cookie Without Name", source: "cookie", expectError: true},
+		{name: "Unknown Source", source: "body", keyName: "user", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := domain.ParseHashKey(tt.source, tt.keyName)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if key != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, key)
+			}
+		})
+	}
+}
+
+func TestRingHashBalancer_SourcesAgree(t *testing.T) {
+	backends := newRingBackends(5)
+
+	header := httptest.NewRequest(http.MethodGet, "/", nil)
+	header.Header.Set("X-User", "alice")
+	cookie := httptest.NewRequest(http.MethodGet, "/", nil)
+	cookie.AddCookie(&http.Cookie{Name: "user", Value: "alice"})
+	query := httptest.NewRequest(http.MethodGet, "/?user=alice", nil)
+	ip := httptest.NewRequest(http.MethodGet, "/", nil)
+	ip.RemoteAddr = "alice:1234"
+
+	expected := newRingHashBalancer(t, domain.HashKey{Source: domain.HashSourceHeader, Name: "X-User"}).Next(header, backends)
+	tests := []struct {
+		name string
+		key  domain.HashKey
+		req  *http.Request
+	}{
+		{name: "Cookie", key: domain.HashKey{Source: domain.HashSourceCookie, Name: "user"}, req: cookie},
+		{name: "Query", key: domain.HashKey{Source: domain.HashSourceQuery, Name: "user"}, req: query},
+		{name: "Client IP", key: domain.HashKey{Source: domain.HashSourceIP}, req: ip},
+		{name: "Missing Header Uses Client IP", key: domain.HashKey{Source: domain.HashSourceHeader, Name: "X-User"}, req: ip},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newRingHashBalancer(t, tt.key).Next(tt.req, backends); got != expected {
+				t.Errorf("Expected %s for the same key, got %v", expected.URL, got)
+			}
+		})
+	}
+}
+
+func TestRingHashBalancer_MinimalMovement(t *testing.T) {
+	key := domain.HashKey{Source: domain.HashSourceHeader, Name: "X-User"}
+	backends := newRingBackends(4)
+	before, after := newRingHashBalancer(t, key), newRingHashBalancer(t, key)
+
+	const keys = 2000
+	counts := make(map[*domain.Server]int)
+	moved := 0
+	for i := range keys {
+		req := requestWithUser(fmt.Sprintf("user-%d", i))
+		old := before.Next(req, backends[:3])
+		counts[old]++
+		current := after.Next(req, backends)
+		if current != old {
+			moved++
+			if current != backends[3] {
+				t.Fatalf("Expected moved keys to go to the new backend, got %s", current.URL)
+			}
+		}
+	}
+	// A fourth backend should take about a quarter of the keys
+	if moved < keys/8 || moved > keys*3/8 {
+		t.Errorf("Expected about %d keys to move, got %d", keys/4, moved)
+	}
+	for _, server := range backends[:3] {
+		if counts[server] < keys/6 {
+			t.Errorf("Expected keys to spread evenly, %s got %d of %d", server.URL, counts[server], keys)
+		}
+	}
+}
+
+func TestRingHashBalancer_FallsBackToNextHealthy(t *testing.T) {
+	balancer := newRingHashBalancer(t, domain.HashKey{Source: domain.HashSourceHeader, Name: "X-User"})
+	backends := newRingBackends(3)
+	req := requestWithUser("alice")
+
+	owner := balancer.Next(req, backends)
+	owner.SetHealthStatus(false)
+	fallback := balancer.Next(req, backends)
+	if fallback == nil || fallback == owner {
+		t.Fatalf("Expected another backend while the owner is unhealthy, got %v", fallback)
+	}
+	if again := balancer.Next(req, backends); again != fallback {
+		t.Errorf("Expected the fallback to be stable, got %s and %s", fallback.URL, again.URL)
+	}
+
+	owner.SetHealthStatus(true)
+	if got := balancer.Next(req, backends); got != owner {
+		t.Errorf("Expected the key to return to its owner, got %s", got.URL)
+	}
+
+	for _, server := range backends {
+		server.SetHealthStatus(false)
+	}
+	if got := balancer.Next(req, backends); got != nil {
+		t.Errorf("Expected nil without healthy backends, got %s", got.URL)
+	}
+}
@@ -0,0 +1,128 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/thetonbr/breezegate/internal/domain"
+	"github.com/thetonbr/breezegate/internal/handlers"
+)
+
+func TestLoadBalancer_PathMatching(t *testing.T) {
+	lb := domain.NewLoadBalancer()
+	lb.AddRoute("/", []*domain.Server{newTestServer("http://root:8080", true)})
+	lb.AddRoute("/api/v1", []*domain.Server{newTestServer("http://v1:8080", true)})
+	lb.AddRoute("/api/v1/admin/", []*domain.Server{newTestServer("http://admin:8080", true)})
+
+	routes := []struct {
+		path  string
+		match domain.MatchType
+		url   string
+	}{
+		{path: "/api/v1/health", match: domain.MatchExact, url: "http://health:8080"},
+		{path: `^/static/.*\.css$`, match: domain.MatchRegex, url: "http://static:8080"},
+	}
+	for _, r := range routes {
+		if err := lb.AddRouteWithMatch(r.path, r.match, []*domain.Server{newTestServer(r.url, true)}); err != nil {
+			t.Fatalf("Failed to add route %s: %v", r.path, err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		expectedURL string
+	}{
+		{name: "Prefix itself", path: "/api/v1", expectedURL: "http://v1:8080"},
+		{name: "Below prefix", path: "/api/v1/users", expectedURL: "http://v1:8080"},
+		{name: "Trailing slash", path: "/api/v1/", expectedURL: "http://v1:8080"},
+		{name: "Segment boundary", path: "/api/v10", expectedURL: "http://root:8080"},
+		{name: "Longest prefix", path: "/api/v1/admin/users", expectedURL: "http://admin:8080"},
+		{name: "Exact route", path: "/api/v1/health", expectedURL: "http://health:8080"},
+		{name: "Below exact route", path: "/api/v1/health/live", expectedURL: "http://v1:8080"},
+		{name: "Regex route", path: "/static/css/site.css", expectedURL: "http://static:8080"},
+		{name: "Regex miss", path: "/static/site.js", expectedURL: "http://root:8080"},
+		{name: "Root fallback", path: "/unknown", expectedURL: "http://root:8080"},
+		{name: "Dot segments leave prefix", path: "/api/v1/../../unknown", expectedURL: "http://root:8080"},
+		{name: "Dot segments enter prefix", path: "/api/v1/users/../admin/users", expectedURL: "http://admin:8080"},
+		{name: "Dot segments enter exact route", path: "/api/v1/./health", expectedURL: "http://health:8080"},
+		{name: "Repeated slashes", path: "/api//v1/admin//users", expectedURL: "http://admin:8080"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := lb.GetBackendForPath(tt.path)
+			if server == nil {
+				t.Fatalf("Expected a server for %s, got nil", tt.path)
+			}
+			if server.URL.String() != tt.expectedURL {
+				t.Errorf("Expected server URL %s, got %s", tt.expectedURL, server.URL.String())
+			}
+		})
+	}
+}
+
+func TestLoadBalancer_NoMatchingRoute(t *testing.T) {
+	lb := domain.NewLoadBalancer()
+	lb.AddRoute("/api", []*domain.Server{newTestServer("http://localhost:8080", true)})
+
+	if server := lb.GetBackendForPath("/other"); server != nil {
+		t.Errorf("Expected no server, got %s", server.URL.String())
+	}
+	if server := lb.GetBackendForPath("/apis"); server != nil {
+		t.Errorf("Expected no server across segment boundary, got %s", server.URL.String())
+	}
+}
+
+func TestLoadBalancer_InvalidMatch(t *testing.T) {
+	lb := domain.NewLoadBalancer()
+	servers := []*domain.Server{newTestServer("http://localhost:8080", true)}
+
+	if err := lb.AddRouteWithMatch("/api/(", domain.MatchRegex, servers); err == nil {
+		t.Error("Expected error for invalid regex route")
+	}
+	if err := lb.AddRouteWithMatch("/api", domain.MatchType("glob"), servers); err == nil {
+		t.Error("Expected error for unknown match type")
+	}
+}
+
+func TestLoadBalancerHandler_ProxiesCleanedPath(t *testing.T) {
+	paths := make(chan string, 1)
+	public := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		paths <- r.URL.Path
+	}))
+	defer public.Close()
+
+	lb := domain.NewLoadBalancer()
+	lb.AddRoute("/public", []*domain.Server{newTestServer(public.URL, true)})
+	handler := handlers.NewLoadBalancerHandler(lb)
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedPath   string
+	}{
+		{name: "Inside Route", path: "/public/./docs/../index.html", expectedStatus: http.StatusOK, expectedPath: "/public/index.html"},
+		{name: "Escaping Route", path: "/public/../admin", expectedStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.URL.Path = tt.path
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if tt.expectedPath == "" {
+				return
+			}
+			if path := <-paths; path != tt.expectedPath {
+				t.Errorf("Expected the backend to receive %s, got %s", tt.expectedPath, path)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package test
 import (
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/thetonbr/breezegate/internal/domain"
 )
@@ -131,3 +132,87 @@ func TestServerConcurrentHealthStatus(t *testing.T) {
 		t.Error("Health status should be either true or false")
 	}
 }
+
+func TestServerAdminState(t *testing.T) {
+	tests := []struct {
+		name              string
+		state             domain.AdminState
+		drainTimeout      time.Duration
+		expectedAvailable bool
+		expectedAffinity  bool
+	}{
+		{name: "Active", state: domain.StateActive, expectedAvailable: true, expectedAffinity: true},
+		{name: "Draining", state: domain.StateDraining, drainTimeout: time.Hour, expectedAffinity: true},
+		{name: "Draining Without Timeout", state: domain.StateDraining, expectedAffinity: true},
+		{name: "Drain Timed Out", state: domain.StateDraining, drainTimeout: time.Nanosecond},
+		{name: "Disabled", state: domain.StateDisabled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := domain.NewServer("http://localhost:8080")
+			if err != nil {
+				t.Fatalf("Failed to create server: %v", err)
+			}
+			server.SetAdminState(tt.state, tt.drainTimeout)
+			time.Sleep(time.Millisecond)
+
+			if server.AdminState() != tt.state {
+				t.Errorf("Expected state %s, got %s", tt.state, server.AdminState())
+			}
+			if server.IsAvailable() != tt.expectedAvailable {
+				t.Errorf("Expected available %v, got %v", tt.expectedAvailable, server.IsAvailable())
+			}
+			if server.AcceptsAffinity() != tt.expectedAffinity {
+				t.Errorf("Expected affinity %v, got %v", tt.expectedAffinity, server.AcceptsAffinity())
+			}
+			if !server.GetHealthStatus() {
+				t.Error("Expected the state not to change the health status")
+			}
+		})
+	}
+}
+
+func TestServerDrained(t *testing.T) {
+	server, err := domain.NewServer("http://localhost:8080")
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	server.StartRequest()
+	if server.IsDrained() {
+		t.Error("Expected an active server not to be drained")
+	}
+	server.SetAdminState(domain.StateDraining, time.Hour)
+	if server.IsDrained() {
+		t.Error("Expected a draining server with a request in flight not to be drained")
+	}
+	server.EndRequest()
+	if !server.IsDrained() {
+		t.Error("Expected a draining server without requests in flight to be drained")
+	}
+	if server.InFlight() != 0 {
+		t.Errorf("Expected 0 requests in flight, got %d", server.InFlight())
+	}
+}
+
+func TestServerForcedHealth(t *testing.T) {
+	server, err := domain.NewServer("http://localhost:8080")
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	server.ForceHealthStatus(false)
+	server.SetHealthStatus(true)
+	if server.GetHealthStatus() {
+		t.Error("Expected a forced health status to override health checks")
+	}
+	if !server.IsHealthForced() {
+		t.Error("Expected the health status to be reported as forced")
+	}
+
+	server.ClearForcedHealthStatus()
+	if !server.GetHealthStatus() || !server.IsAvailable() {
+		t.Error("Expected the health check status to apply after clearing the forced status")
+	}
+}
@@ -0,0 +1,158 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/thetonbr/breezegate/internal/domain"
+	"github.com/thetonbr/breezegate/internal/handlers"
+)
+
+func TestLoadBalancer_GetBackendByHost(t *testing.T) {
+	lb := domain.NewLoadBalancer()
+	hostRoutes := []struct {
+		host string
+		url  string
+	}{
+		{host: "example.com", url: "http://example:8080"},
+		{host: "other.com", url: "http://other:8080"},
+		{host: "*.example.com", url: "http://wildcard:8080"},
+		{host: "*.api.example.com", url: "http://api-wildcard:8080"},
+	}
+	for _, hr := range hostRoutes {
+		err := lb.AddHostRoute(hr.host, "/api", domain.MatchPrefix, []*domain.Server{newTestServer(hr.url, true)})
+		if err != nil {
+			t.Fatalf("Failed to add route for %s: %v", hr.host, err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		host        string
+		expectedURL string
+	}{
+		{name: "Exact host", host: "example.com", expectedURL: "http://example:8080"},
+		{name: "Same path on other host", host: "other.com", expectedURL: "http://other:8080"},
+		{name: "Host with port", host: "other.com:8443", expectedURL: "http://other:8080"},
+		{name: "Mixed case host", host: "Example.COM", expectedURL: "http://example:8080"},
+		{name: "Wildcard host", host: "www.example.com", expectedURL: "http://wildcard:8080"},
+		{name: "Longest wildcard", host: "v1.api.example.com", expectedURL: "http://api-wildcard:8080"},
+		{name: "Unknown host", host: "unknown.org", expectedURL: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := lb.GetBackend(tt.host, "/api/users")
+			if tt.expectedURL == "" {
+				if server != nil {
+					t.Errorf("Expected no server, got %s", server.URL.String())
+				}
+				return
+			}
+			if server == nil {
+				t.Fatalf("Expected server %s, got nil", tt.expectedURL)
+			}
+			if server.URL.String() != tt.expectedURL {
+				t.Errorf("Expected server URL %s, got %s", tt.expectedURL, server.URL.String())
+			}
+		})
+	}
+}
+
+func TestLoadBalancer_DefaultHost(t *testing.T) {
+	lb := domain.NewLoadBalancer()
+	lb.AddRoute("/", []*domain.Server{newTestServer("http://hostless:8080", true)})
+
+	server := lb.GetBackend("unknown.org", "/")
+	if server == nil || server.URL.String() != "http://hostless:8080" {
+		t.Fatalf("Expected host-less route to serve unknown hosts, got %v", server)
+	}
+
+	err := lb.AddHostRoute("example.com", "/", domain.MatchPrefix, []*domain.Server{newTestServer("http://example:8080", true)})
+	if err != nil {
+		t.Fatalf("Failed to add route: %v", err)
+	}
+	lb.SetDefaultHost("example.com")
+
+	server = lb.GetBackend("unknown.org", "/")
+	if server == nil || server.URL.String() != "http://example:8080" {
+		t.Errorf("Expected default host to serve unknown hosts, got %v", server)
+	}
+}
+
+func TestLoadBalancer_HostAlias(t *testing.T) {
+	lb := domain.NewLoadBalancer()
+	err := lb.AddHostRoute("example.com", "/", domain.MatchPrefix, []*domain.Server{newTestServer("http://example:8080", true)})
+	if err != nil {
+		t.Fatalf("Failed to add route: %v", err)
+	}
+	lb.AddHostAlias("www.example.com", "example.com")
+	lb.AddHostAlias("*.example.org", "example.com")
+
+	for _, host := range []string{"example.com", "WWW.example.com", "shop.example.org"} {
+		server := lb.GetBackend(host, "/")
+		if server == nil || server.URL.String() != "http://example:8080" {
+			t.Errorf("Expected alias %s to share the routes of example.com, got %v", host, server)
+		}
+	}
+	if server := lb.GetBackend("example.org", "/"); server != nil {
+		t.Errorf("Expected wildcard alias not to match its apex, got %s", server.URL.String())
+	}
+}
+
+func TestLoadBalancerHandler_RoutesByHost(t *testing.T) {
+	newBackend := func(body string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte(body))
+		}))
+	}
+	backendA := newBackend("a")
+	defer backendA.Close()
+	backendB := newBackend("b")
+	defer backendB.Close()
+
+	lb := domain.NewLoadBalancer()
+	if err := lb.AddHostRoute("a.test", "/api", domain.MatchPrefix, []*domain.Server{newTestServer(backendA.URL, true)}); err != nil {
+		t.Fatalf("Failed to add route: %v", err)
+	}
+	if err := lb.AddHostRoute("b.test", "/api", domain.MatchPrefix, []*domain.Server{newTestServer(backendB.URL, true)}); err != nil {
+		t.Fatalf("Failed to add route: %v", err)
+	}
+	handler := handlers.NewLoadBalancerHandler(lb)
+
+	for _, host := range []string{"a", "b"} {
+		req := httptest.NewRequest(http.MethodGet, "http://"+host+".test/api/items", http.NoBody)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Body.String() != host {
+			t.Errorf("Expected response %q for host %s.test, got %q", host, host, w.Body.String())
+		}
+	}
+}
+
+func TestLoadBalancer_Replace(t *testing.T) {
+	lb := domain.NewLoadBalancer()
+	oldServer := newTestServer("http://old:8080", true)
+	err := lb.AddHostRoute("example.com", "/api", domain.MatchPrefix, []*domain.Server{oldServer})
+	if err != nil {
+		t.Fatalf("Failed to add route: %v", err)
+	}
+
+	next := domain.NewLoadBalancer()
+	err = next.AddHostRoute("example.org", "/", domain.MatchPrefix, []*domain.Server{newTestServer("http://new:8080", true)})
+	if err != nil {
+		t.Fatalf("Failed to add route: %v", err)
+	}
+	next.SetDefaultHost("example.org")
+	lb.Replace(next)
+
+	if lb.Host("example.com") != nil {
+		t.Error("Expected removed host to be gone after replace")
+	}
+	server := lb.GetBackend("example.com", "/api")
+	if server == nil || server.URL.String() != "http://new:8080" {
+		t.Errorf("Expected unknown host to use the new default host, got %v", server)
+	}
+}